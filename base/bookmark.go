@@ -0,0 +1,56 @@
+package base
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Bookmark is a saved location: a line of a file or the first line of
+// the file matching a regexp.
+type Bookmark struct {
+	Path   string
+	Line   int
+	Regexp string
+}
+
+// ParseBookmark parses a location of the form path:line, path:/regexp/
+// or path. Relative paths are made absolute.
+func ParseBookmark(loc string) (Bookmark, error) {
+	var bm Bookmark
+	path := loc
+	if i := strings.Index(loc, ":/"); i >= 0 && strings.HasSuffix(loc, "/") && len(loc) > i+2 {
+		path, bm.Regexp = loc[:i], loc[i+2:len(loc)-1]
+		if _, err := regexp.Compile(bm.Regexp); err != nil {
+			return bm, fmt.Errorf("bad bookmark regexp %q: %v", bm.Regexp, err)
+		}
+	} else if i := strings.LastIndex(loc, ":"); i >= 0 {
+		if n, err := strconv.Atoi(loc[i+1:]); err == nil && n > 0 {
+			path, bm.Line = loc[:i], n
+		}
+	}
+	if path == "" {
+		return bm, fmt.Errorf("bookmark %q has no path", loc)
+	}
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return bm, fmt.Errorf("can't make %s absolute: %v", path, err)
+	}
+	bm.Path = abs
+	return bm, nil
+}
+
+// String returns the location of bm in the form accepted by
+// ParseBookmark.
+func (bm Bookmark) String() string {
+	switch {
+	case bm.Regexp != "":
+		return bm.Path + ":/" + bm.Regexp + "/"
+	case bm.Line > 0:
+		return bm.Path + ":" + strconv.Itoa(bm.Line)
+	}
+	return bm.Path
+}
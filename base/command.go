@@ -0,0 +1,431 @@
+package base
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// UsageError is a subcommand invoked with the wrong arguments.
+type UsageError struct {
+	Problem string
+}
+
+func (e *UsageError) Error() string {
+	return e.Problem
+}
+
+// ExitCode returns the exit status for err returned by RunCommand: 0 for
+// success, 2 for bad usage and 1 for other failures.
+func ExitCode(err error) int {
+	var ue *UsageError
+	switch {
+	case err == nil:
+		return 0
+	case errors.As(err, &ue):
+		return 2
+	default:
+		return 1
+	}
+}
+
+// commandEnv is what the subcommands operate on.
+type commandEnv struct {
+	gc *GlobalConfiguration
+	// useproject overrides the current project as the target of the
+	// config and prefix subcommands.
+	useproject string
+	layers     Layers
+	out        io.Writer
+}
+
+// target returns the name and contents of the project changed by the
+// config and prefix subcommands.
+func (env *commandEnv) target() (string, *Project, error) {
+	name := env.gc.Currentproject
+	if env.useproject != "" {
+		name = env.useproject
+	}
+	p, ok := env.gc.Projects[name]
+	if !ok {
+		return name, nil, fmt.Errorf("no project %q: add one with leap project add", name)
+	}
+	return name, p, nil
+}
+
+// command is a subcommand. run reports if it changed the configuration.
+type command struct {
+	args string
+	// min and max bound the number of arguments. max is -1 for no bound.
+	min, max int
+	run      func(env *commandEnv, args []string) (bool, error)
+	// layered commands read every layer of the configuration instead of
+	// changing the user file.
+	layered bool
+}
+
+// commands are the subcommands that edit the configuration: leap <group>
+// <verb> <args>.
+var commands = map[string]map[string]command{
+	"config": {
+		"get":   {args: "[key]", min: 0, max: 1, run: configGet},
+		"set":   {args: "key value", min: 2, max: 2, run: configSet},
+		"unset": {args: "key", min: 1, max: 1, run: configUnset},
+		"show":  {args: "", min: 0, max: 0, run: configShow, layered: true},
+	},
+	"project": {
+		"add": {args: "name", min: 1, max: 1, run: projectAdd},
+		"rm":  {args: "name", min: 1, max: 1, run: projectRm},
+		"ls":  {args: "", min: 0, max: 0, run: projectLs},
+		"use": {args: "name", min: 1, max: 1, run: projectUse},
+	},
+	"prefix": {
+		"add": {args: "path...", min: 1, max: -1, run: prefixAdd},
+		"rm":  {args: "path...", min: 1, max: -1, run: prefixRm},
+	},
+}
+
+// IsCommand reports if args invoke a subcommand. Alfred passes the query
+// as a single argument so a query can't be mistaken for a subcommand.
+func IsCommand(args []string) bool {
+	return len(args) >= 2 && commands[args[0]] != nil
+}
+
+// CommandUsage writes the usage of the subcommands to w.
+func CommandUsage(w io.Writer) {
+	groups := make([]string, 0, len(commands))
+	for g := range commands {
+		groups = append(groups, g)
+	}
+	sort.Strings(groups)
+	for _, g := range groups {
+		for _, v := range sortedVerbs(g) {
+			fmt.Fprintf(w, "	leap %s %s %s\n", g, v, commands[g][v].args)
+		}
+	}
+	fmt.Fprintf(w, "	config keys: %s\n", strings.Join(settingNames(), ", "))
+}
+
+func sortedVerbs(group string) []string {
+	verbs := make([]string, 0, len(commands[group]))
+	for v := range commands[group] {
+		verbs = append(verbs, v)
+	}
+	sort.Strings(verbs)
+	return verbs
+}
+
+// RunCommand runs the subcommand given by args on the configuration
+// file fp while holding its lock, writing any output to out. A missing
+// configuration file is created. Legacy configurations must be upgraded
+// first.
+func RunCommand(fp string, args []string, out io.Writer) error {
+	c, rest, err := lookupCommand(args)
+	if err != nil {
+		return err
+	}
+	if c.layered {
+		_, err := c.run(&commandEnv{layers: layersFor(fp), out: out}, rest)
+		return err
+	}
+
+	unlock, err := lockConfig(fp)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	gc := &GlobalConfiguration{
+		Version:  ConfigVersion,
+		Projects: make(map[string]*Project),
+	}
+	b, err := os.ReadFile(fp)
+	switch {
+	case err == nil:
+		var legacy *Configuration
+		gc, legacy, err = decodeConfig(b)
+		if err != nil {
+			return fmt.Errorf("bad config file %s: %v", fp, err)
+		}
+		if legacy != nil {
+			return fmt.Errorf("leap %s requires an upgraded configuration: run leap -updateconfig", args[0])
+		}
+	case !os.IsNotExist(err):
+		return fmt.Errorf("can't read config file %s because %v", fp, err)
+	}
+
+	env := &commandEnv{gc: gc, useproject: *useproject, out: out}
+	changed, err := c.run(env, rest)
+	if err != nil || !changed {
+		return err
+	}
+	return saveNewConfig(gc, fp)
+}
+
+// lookupCommand returns the subcommand given by args and its arguments.
+func lookupCommand(args []string) (command, []string, error) {
+	group, ok := commands[args[0]]
+	if !ok {
+		return command{}, nil, &UsageError{fmt.Sprintf("unknown command %q", args[0])}
+	}
+	if len(args) < 2 {
+		return command{}, nil, &UsageError{fmt.Sprintf("leap %s needs one of: %s", args[0], strings.Join(sortedVerbs(args[0]), ", "))}
+	}
+	c, ok := group[args[1]]
+	if !ok {
+		return command{}, nil, &UsageError{fmt.Sprintf("leap %s has no %q: use one of %s", args[0], args[1], strings.Join(sortedVerbs(args[0]), ", "))}
+	}
+	rest := args[2:]
+	if len(rest) < c.min || c.max >= 0 && len(rest) > c.max {
+		return command{}, nil, &UsageError{fmt.Sprintf("usage: leap %s %s %s", args[0], args[1], c.args)}
+	}
+	return c, rest, nil
+}
+
+// runCommand runs the subcommand given by args in env.
+func runCommand(env *commandEnv, args []string) (bool, error) {
+	c, rest, err := lookupCommand(args)
+	if err != nil {
+		return false, err
+	}
+	return c.run(env, rest)
+}
+
+// setting is a value of a project that can be changed with leap config.
+type setting struct {
+	get func(p *Project) string
+	// value is the field as stored in the configuration.
+	value func(p *Project) interface{}
+	// set is nil for settings changed by other subcommands.
+	set   func(p *Project, v string) error
+	unset func(p *Project)
+}
+
+func stringSetting(field func(p *Project) *string) setting {
+	return setting{
+		get:   func(p *Project) string { return *field(p) },
+		value: func(p *Project) interface{} { return *field(p) },
+		set: func(p *Project, v string) error {
+			*field(p) = v
+			return nil
+		},
+		unset: func(p *Project) { *field(p) = "" },
+	}
+}
+
+func boolSetting(field func(p *Project) *bool) setting {
+	return setting{
+		get:   func(p *Project) string { return strconv.FormatBool(*field(p)) },
+		value: func(p *Project) interface{} { return *field(p) },
+		set: func(p *Project, v string) error {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return &UsageError{fmt.Sprintf("%q is not true or false", v)}
+			}
+			*field(p) = b
+			return nil
+		},
+		unset: func(p *Project) { *field(p) = false },
+	}
+}
+
+func levelSetting(field func(p *Project) *string) setting {
+	s := stringSetting(field)
+	s.set = func(p *Project, v string) error {
+		var l slog.Level
+		if err := l.UnmarshalText([]byte(v)); err != nil {
+			return &UsageError{fmt.Sprintf("%q is not debug, info, warn or error", v)}
+		}
+		*field(p) = v
+		return nil
+	}
+	return s
+}
+
+var settings = map[string]setting{
+	"host":       stringSetting(func(p *Project) *string { return &p.Host }),
+	"indexpath":  stringSetting(func(p *Project) *string { return &p.Indexpath }),
+	"remotepath": stringSetting(func(p *Project) *string { return &p.Remotepath }),
+	"mount":      stringSetting(func(p *Project) *string { return &p.Mount }),
+	"opener":     stringSetting(func(p *Project) *string { return &p.Opener }),
+	"remote":     boolSetting(func(p *Project) *bool { return &p.Remote }),
+	"git":        boolSetting(func(p *Project) *bool { return &p.Git }),
+	"history":    boolSetting(func(p *Project) *bool { return &p.History }),
+	"loglevel":   levelSetting(func(p *Project) *string { return &p.Loglevel }),
+	"prefixes": {
+		get:   func(p *Project) string { return strings.Join(p.Prefixes, " ") },
+		value: func(p *Project) interface{} { return p.Prefixes },
+		unset: func(p *Project) { p.Prefixes = []string{} },
+	},
+}
+
+func settingNames() []string {
+	names := make([]string, 0, len(settings))
+	for n := range settings {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func lookupSetting(key string) (setting, error) {
+	s, ok := settings[key]
+	if !ok {
+		return s, &UsageError{fmt.Sprintf("unknown key %q: use one of %s", key, strings.Join(settingNames(), ", "))}
+	}
+	return s, nil
+}
+
+// configGet prints the value of a setting or all of them.
+func configGet(env *commandEnv, args []string) (bool, error) {
+	_, p, err := env.target()
+	if err != nil {
+		return false, err
+	}
+	if len(args) == 1 {
+		s, err := lookupSetting(args[0])
+		if err != nil {
+			return false, err
+		}
+		fmt.Fprintln(env.out, s.get(p))
+		return false, nil
+	}
+	for _, n := range settingNames() {
+		fmt.Fprintf(env.out, "%s\t%s\n", n, settings[n].get(p))
+	}
+	return false, nil
+}
+
+// configShow prints the effective configuration and where each of its
+// values came from.
+func configShow(env *commandEnv, args []string) (bool, error) {
+	ec, err := env.layers.Load()
+	if err != nil {
+		return false, err
+	}
+	ec.Print(env.out)
+	return false, nil
+}
+
+func configSet(env *commandEnv, args []string) (bool, error) {
+	s, err := lookupSetting(args[0])
+	if err != nil {
+		return false, err
+	}
+	if s.set == nil {
+		return false, &UsageError{fmt.Sprintf("%s can't be set: use leap prefix", args[0])}
+	}
+	_, p, err := env.target()
+	if err != nil {
+		return false, err
+	}
+	return true, s.set(p, args[1])
+}
+
+func configUnset(env *commandEnv, args []string) (bool, error) {
+	s, err := lookupSetting(args[0])
+	if err != nil {
+		return false, err
+	}
+	_, p, err := env.target()
+	if err != nil {
+		return false, err
+	}
+	s.unset(p)
+	return true, nil
+}
+
+// projectAdd adds an empty project. The first project becomes the
+// current project.
+func projectAdd(env *commandEnv, args []string) (bool, error) {
+	name := args[0]
+	if _, ok := env.gc.Projects[name]; ok {
+		return false, fmt.Errorf("project %s already exists", name)
+	}
+	env.gc.Projects[name] = &Project{Prefixes: []string{}}
+	if len(env.gc.Projects) == 1 {
+		env.gc.Currentproject = name
+	}
+	return true, nil
+}
+
+func projectRm(env *commandEnv, args []string) (bool, error) {
+	name := args[0]
+	if _, ok := env.gc.Projects[name]; !ok {
+		return false, fmt.Errorf("no project %s", name)
+	}
+	if name == env.gc.Currentproject {
+		return false, fmt.Errorf("can't remove the current project %s: use another first", name)
+	}
+	delete(env.gc.Projects, name)
+	return true, nil
+}
+
+// projectLs lists the projects, marking the current one with a *.
+func projectLs(env *commandEnv, args []string) (bool, error) {
+	for _, n := range env.gc.ProjectNames() {
+		mark := " "
+		if n == env.gc.Currentproject {
+			mark = "*"
+		}
+		fmt.Fprintf(env.out, "%s %s\n", mark, n)
+	}
+	return false, nil
+}
+
+func projectUse(env *commandEnv, args []string) (bool, error) {
+	name := args[0]
+	if _, ok := env.gc.Projects[name]; !ok {
+		return false, fmt.Errorf("no project %s: add it with leap project add", name)
+	}
+	env.gc.Currentproject = name
+	return true, nil
+}
+
+// prefixAdd adds trimming prefixes to the project. Relative paths are
+// made absolute.
+func prefixAdd(env *commandEnv, args []string) (bool, error) {
+	_, p, err := env.target()
+	if err != nil {
+		return false, err
+	}
+	for _, a := range args {
+		a, err := filepath.Abs(a)
+		if err != nil {
+			return false, err
+		}
+		if !slices.Contains(p.Prefixes, a) {
+			p.Prefixes = append(p.Prefixes, a)
+		}
+	}
+	return true, nil
+}
+
+func prefixRm(env *commandEnv, args []string) (bool, error) {
+	name, p, err := env.target()
+	if err != nil {
+		return false, err
+	}
+	for _, a := range args {
+		abs, err := filepath.Abs(a)
+		if err != nil {
+			return false, err
+		}
+		i := slices.Index(p.Prefixes, a)
+		if i < 0 {
+			i = slices.Index(p.Prefixes, abs)
+		}
+		if i < 0 {
+			return false, fmt.Errorf("project %s has no prefix %s", name, a)
+		}
+		p.Prefixes = append(p.Prefixes[:i], p.Prefixes[i+1:]...)
+	}
+	return true, nil
+}
@@ -0,0 +1,166 @@
+package base
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestRunCommand(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "leaprc")
+
+	for _, tc := range []struct {
+		args []string
+		out  string
+		code int
+	}{
+		{[]string{"config", "get"}, "", 1},
+		{[]string{"project", "add", "a"}, "", 0},
+		{[]string{"project", "add", "b"}, "", 0},
+		{[]string{"project", "add", "b"}, "", 1},
+		{[]string{"project", "ls"}, "* a\n  b\n", 0},
+		{[]string{"config", "set", "host", "ahost"}, "", 0},
+		{[]string{"config", "set", "remote", "true"}, "", 0},
+		{[]string{"config", "set", "remote", "maybe"}, "", 2},
+		{[]string{"config", "set", "colour", "blue"}, "", 2},
+		{[]string{"config", "set", "prefixes", "/a"}, "", 2},
+		{[]string{"config", "set", "host"}, "", 2},
+		{[]string{"config", "set", "loglevel", "debug"}, "", 0},
+		{[]string{"config", "set", "loglevel", "chatty"}, "", 2},
+		{[]string{"config", "get", "loglevel"}, "debug\n", 0},
+		{[]string{"config", "get", "host"}, "ahost\n", 0},
+		{[]string{"config", "get", "remote"}, "true\n", 0},
+		{[]string{"config", "unset", "remote"}, "", 0},
+		{[]string{"config", "get", "remote"}, "false\n", 0},
+		{[]string{"prefix", "add", "/a/src", "/a/gen", "/a/src"}, "", 0},
+		{[]string{"prefix", "rm", "/a/gen"}, "", 0},
+		{[]string{"prefix", "rm", "/a/gen"}, "", 1},
+		{[]string{"prefix", "add"}, "", 2},
+		{[]string{"config", "get", "prefixes"}, "/a/src\n", 0},
+		{[]string{"project", "rm", "a"}, "", 1},
+		{[]string{"project", "use", "c"}, "", 1},
+		{[]string{"project", "use", "b"}, "", 0},
+		{[]string{"config", "get", "host"}, "\n", 0},
+		{[]string{"project", "rm", "a"}, "", 0},
+		{[]string{"project", "ls"}, "* b\n", 0},
+		{[]string{"project", "frob"}, "", 2},
+	} {
+		out := new(bytes.Buffer)
+		err := RunCommand(name, tc.args, out)
+		if got, want := ExitCode(err), tc.code; got != want {
+			t.Errorf("%v: exit code got %d want %d (err %v)", tc.args, got, want, err)
+		}
+		if got, want := out.String(), tc.out; got != want {
+			t.Errorf("%v: output got %q want %q", tc.args, got, want)
+		}
+	}
+
+	problems, err := CheckConfiguration(name)
+	if err != nil {
+		t.Fatalf("can't check the result because %v", err)
+	}
+	if len(problems) != 0 {
+		t.Errorf("result has problems: %v", problems)
+	}
+}
+
+func TestRunCommandLegacy(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "leaprc")
+	contents, err := os.ReadFile(filepath.Join("testdata", "leaprc_original"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(name, contents, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := RunCommand(name, []string{"project", "add", "a"}, new(bytes.Buffer)); ExitCode(err) != 1 {
+		t.Errorf("legacy configuration got %v want an error", err)
+	}
+	after, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(after, contents) {
+		t.Errorf("legacy configuration was changed")
+	}
+}
+
+func TestIsCommand(t *testing.T) {
+	for _, tc := range []struct {
+		args []string
+		want bool
+	}{
+		{[]string{"config", "get"}, true},
+		{[]string{"prefix", "add", "/a"}, true},
+		{[]string{"project"}, false},
+		{[]string{"config get"}, false},
+		{[]string{"foo.go", "bar"}, false},
+		{[]string{}, false},
+	} {
+		if got := IsCommand(tc.args); got != tc.want {
+			t.Errorf("IsCommand(%q) got %v want %v", tc.args, got, tc.want)
+		}
+	}
+}
+
+func TestFlagCommands(t *testing.T) {
+	defer func() {
+		*setproject, *host, *setprefix, *remote, *local = "", "", false, false, false
+	}()
+	gc := &GlobalConfiguration{Projects: map[string]*Project{"a": {}}}
+
+	*setproject, *host, *setprefix = "b", "bhost", true
+	cmds, err := flagCommands(gc, []string{"/b/src"})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	want := [][]string{
+		{"project", "add", "b"},
+		{"project", "use", "b"},
+		{"config", "set", "host", "bhost"},
+		{"config", "unset", "prefixes"},
+		{"prefix", "add", "/b/src"},
+	}
+	if !reflect.DeepEqual(cmds, want) {
+		t.Errorf("got %v want %v", cmds, want)
+	}
+
+	*remote, *local = true, true
+	if _, err := flagCommands(gc, nil); ExitCode(err) != 2 {
+		t.Errorf("-remote -local got %v want a usage error", err)
+	}
+}
+
+func TestUpdateConfigFlags(t *testing.T) {
+	defer func() {
+		*update, *remote, *local = false, false, false
+	}()
+	name := filepath.Join(t.TempDir(), "leaprc")
+	contents, err := os.ReadFile(filepath.Join("testdata", "leaprc_original"))
+	if err != nil {
+		t.Fatalf("can't read starter config because %v", err)
+	}
+	if err := os.WriteFile(name, contents, 0600); err != nil {
+		t.Fatalf("can't write starter config because %v", err)
+	}
+
+	*remote, *local = true, true
+	if err := updateFromFlagsFile(name, nil, new(bytes.Buffer)); ExitCode(err) != 2 {
+		t.Errorf("-remote -local got %v want a usage error", err)
+	}
+
+	*remote, *local, *update = false, false, true
+	if err := updateFromFlagsFile(name, nil, new(bytes.Buffer)); err != nil {
+		t.Fatalf("-updateconfig got error %v", err)
+	}
+	b, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatalf("can't read updated config because %v", err)
+	}
+	if _, legacy, err := decodeConfig(b); err != nil || legacy != nil {
+		t.Errorf("updated config isn't a new config: legacy %v, err %v", legacy, err)
+	}
+}
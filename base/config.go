@@ -7,7 +7,8 @@ import (
 	"io"
 	"os"
 	"path/filepath"
-	"runtime"
+	"sort"
+	"strings"
 
 	"github.com/google/codesearch/index"
 )
@@ -25,17 +26,89 @@ type Configuration struct {
 	Indexpath string
 	Connect   bool
 	Prefixes  []string
+	Git       bool              `json:",omitempty"`
+	Indexes   []Index           `json:"-"` // Additional to Indexpath.
+	Rewrites  []Rewrite         `json:",omitempty"`
+	Mount     string            `json:",omitempty"`
+	Opener    string            `json:",omitempty"`
+	History   bool              `json:",omitempty"`
+	Bookmarks map[string]string `json:",omitempty"`
+	Loglevel  string            `json:",omitempty"`
 	newconfig *GlobalConfiguration
+	project   string
+}
+
+// Index describes one of the index files searched by a project.
+type Index struct {
+	Indexpath  string   `json:"indexpath"`
+	Prefixes   []string `json:"prefixes"`
+	Remotepath string   `json:"remotepath,omitempty"`
+}
+
+// Rewrite maps paths on a project's server under From to where they
+// can be found on the client under To.
+type Rewrite struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// RewritePath applies the rule in rules with the longest matching From
+// to the path p. From only matches whole path elements.
+func RewritePath(rules []Rewrite, p string) string {
+	best := -1
+	for i, r := range rules {
+		from := strings.TrimSuffix(r.From, "/")
+		if p != from && !strings.HasPrefix(p, from+"/") {
+			continue
+		}
+		if best < 0 || len(from) > len(strings.TrimSuffix(rules[best].From, "/")) {
+			best = i
+		}
+	}
+	if best < 0 {
+		return p
+	}
+	r := rules[best]
+	return strings.TrimSuffix(r.To, "/") + strings.TrimPrefix(p, strings.TrimSuffix(r.From, "/"))
 }
 
 // The the new types.
 type Project struct {
-	Host          string   `json:"host"`
-	Indexpath     string   `json:"indexpath"`
-	Remote        bool     `json:"remote"`
-	Prefixes      []string `json:"prefixes"`
-	Remoteproject string   `json:"remoteproject"`
-	Remotepath    string   `json:"remotepath"`
+	Host      string   `json:"host"`
+	Indexpath string   `json:"indexpath"`
+	Remote    bool     `json:"remote"`
+	Prefixes  []string `json:"prefixes"`
+	// Remoteproject is only in version 1 configurations.
+	Remoteproject string `json:"remoteproject,omitempty"`
+	Remotepath    string `json:"remotepath"`
+	// Git ranks files with git activity ahead of others.
+	Git bool `json:"git,omitempty"`
+	// Indexes are additional indexes searched along with Indexpath.
+	Indexes []Index `json:"indexes,omitempty"`
+	// Rewrites map the paths of remote results to local paths.
+	Rewrites []Rewrite `json:"rewrites,omitempty"`
+	// Mount is where the server's export of the project is mounted.
+	Mount string `json:"mount,omitempty"`
+	// Opener says how to open selected files: acme, plumb, editor, code
+	// or a command template such as "subl {file}:{line}".
+	Opener string `json:"opener,omitempty"`
+	// History records the project's queries and the chosen results.
+	History bool `json:"history,omitempty"`
+	// Bookmarks are named locations: path:line or path:/regexp/.
+	Bookmarks map[string]string `json:"bookmarks,omitempty"`
+	// Loglevel is the level of the logged records: debug, info (the
+	// default), warn or error.
+	Loglevel string `json:"loglevel,omitempty"`
+}
+
+// AllIndexes returns every index of the project, starting with the
+// primary one described by Indexpath, Prefixes and Remotepath.
+func (p *Project) AllIndexes() []Index {
+	return append([]Index{{
+		Indexpath:  p.Indexpath,
+		Prefixes:   p.Prefixes,
+		Remotepath: p.Remotepath,
+	}}, p.Indexes...)
 }
 
 type GlobalConfiguration struct {
@@ -47,31 +120,51 @@ type GlobalConfiguration struct {
 // getLegacyConfiguration returns the legacy Configuration object corresponding
 // to the current project in the new style configuration.
 func (gc *GlobalConfiguration) getLegacyConfiguration() (*Configuration, error) {
-	if _, ok := gc.Projects[gc.Currentproject]; !ok {
-		return nil, fmt.Errorf("no project corresponding to selected project %s", gc.Currentproject)
+	return gc.ProjectConfiguration(gc.Currentproject)
+}
+
+// ProjectConfiguration returns the legacy Configuration object for the
+// named project.
+func (gc *GlobalConfiguration) ProjectConfiguration(name string) (*Configuration, error) {
+	np, ok := gc.Projects[name]
+	if !ok {
+		return nil, fmt.Errorf("no project corresponding to selected project %s", name)
 	}
 
-	np := gc.Projects[gc.Currentproject]
 	return &Configuration{
 		Hostname:  np.Host,
 		Indexpath: np.Indexpath,
 		Connect:   np.Remote,
 		Prefixes:  np.Prefixes,
+		Git:       np.Git,
+		Indexes:   np.Indexes,
+		Rewrites:  np.Rewrites,
+		Mount:     np.Mount,
+		Opener:    np.Opener,
+		History:   np.History,
+		Bookmarks: np.Bookmarks,
+		Loglevel:  np.Loglevel,
 		newconfig: gc,
+		project:   name,
 	}, nil
 }
 
+// ProjectNames returns the names of the projects in sorted order.
+func (gc *GlobalConfiguration) ProjectNames() []string {
+	names := make([]string, 0, len(gc.Projects))
+	for n := range gc.Projects {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
 // Filepath returns the path to the leaprc configuration file.
 func Filepath(test bool) string {
 	if test {
 		return "leaprc"
 	}
-
-	home := os.Getenv("HOME")
-	if runtime.GOOS == "windows" && home == "" {
-		home = os.Getenv("USERPROFILE")
-	}
-	return filepath.Clean(filepath.Join(home, ".leaprc"))
+	return platform.configFile()
 }
 
 func GetConfiguration(fp string) (*Configuration, error) {
@@ -87,21 +180,21 @@ func GetConfiguration(fp string) (*Configuration, error) {
 		return nil, err
 	}
 
-	if ns, err := getNewConfig(fd); err == nil {
-		a, b := ns.getLegacyConfiguration()
-		return a, b
-	}
+	defer fd.Close()
 
-	// New way didn't work so try decoding the old way.
-	if _, err := fd.Seek(0, 0); err != nil {
-		return nil, fmt.Errorf("can't seek on config file %s because %v", fp, err)
+	b, err := io.ReadAll(fd)
+	if err != nil {
+		return nil, fmt.Errorf("can't read config file %s because %v", fp, err)
 	}
-
-	config := new(Configuration)
-	decoder := json.NewDecoder(fd)
-	if err := decoder.Decode(config); err != nil {
-		return nil, err
+	ns, config, err := decodeConfig(b)
+	if err != nil {
+		return nil, fmt.Errorf("bad config file %s: %v", fp, err)
+	}
+	if ns != nil {
+		useProject(ns)
+		return ns.getLegacyConfiguration()
 	}
+
 	if config.Indexpath == "" {
 		config.Indexpath = index.File()
 	}
@@ -110,20 +203,61 @@ func GetConfiguration(fp string) (*Configuration, error) {
 
 // getNewConfig reads the new style configuration data from disk.
 func getNewConfig(reader io.Reader) (*GlobalConfiguration, error) {
-	decoder := json.NewDecoder(reader)
-	newstyleconfig := new(GlobalConfiguration)
-	if err := decoder.Decode(newstyleconfig); err != nil {
+	b, err := io.ReadAll(reader)
+	if err != nil {
 		return nil, err
 	}
-	if newstyleconfig.Version != 1 {
-		return nil, fmt.Errorf("unsupported newconfig version, can't decode")
+	newstyleconfig, _, err := decodeConfig(b)
+	if err != nil {
+		return nil, err
 	}
-	if *useproject != "" {
-		newstyleconfig.Currentproject = *useproject
+	if newstyleconfig == nil {
+		return nil, fmt.Errorf("legacy configuration is not a new style configuration")
 	}
+	useProject(newstyleconfig)
 	return newstyleconfig, nil
 }
 
+// useProject makes the project given by -useproject current.
+func useProject(gc *GlobalConfiguration) {
+	if *useproject != "" {
+		gc.Currentproject = *useproject
+	}
+}
+
+// AllIndexes returns the indexes to search: the one described by
+// Indexpath and Prefixes followed by any additional Indexes.
+func (config *Configuration) AllIndexes() []Index {
+	primary := Index{
+		Indexpath: config.Indexpath,
+		Prefixes:  config.Prefixes,
+	}
+	if nc := config.newconfig; nc != nil {
+		if p, ok := nc.Projects[config.project]; ok {
+			primary.Remotepath = p.Remotepath
+		}
+	}
+	return append([]Index{primary}, config.Indexes...)
+}
+
+// AllRewrites returns the Rewrites to apply to remote results. If the
+// project is mounted, every path not otherwise rewritten is found under
+// the Mount.
+func (config *Configuration) AllRewrites() []Rewrite {
+	if config.Mount == "" {
+		return config.Rewrites
+	}
+	rules := make([]Rewrite, 0, len(config.Rewrites)+1)
+	rules = append(rules, config.Rewrites...)
+	return append(rules, Rewrite{From: "/", To: config.Mount})
+}
+
+// Project returns the name of the project that config describes or ""
+// for an old style configuration.
+func (config *Configuration) Project() string {
+	return config.project
+}
+
 func (config *Configuration) GetNewConfiguration() *GlobalConfiguration {
 	return config.newconfig
 }
@@ -139,31 +273,72 @@ func updateConfig(oldconfig *Configuration) *GlobalConfiguration {
 		Currentproject: "default",
 		Projects: map[string]*Project{
 			"default": {
-				Host:          oldconfig.Hostname,
-				Indexpath:     oldconfig.Indexpath,
-				Remote:        oldconfig.Connect,
-				Prefixes:      oldconfig.Prefixes,
-				Remoteproject: "#FIX#",
-				Remotepath:    "#FIX#",
+				Host:       oldconfig.Hostname,
+				Indexpath:  oldconfig.Indexpath,
+				Remote:     oldconfig.Connect,
+				Prefixes:   oldconfig.Prefixes,
+				Git:        oldconfig.Git,
+				Rewrites:   oldconfig.Rewrites,
+				Mount:      oldconfig.Mount,
+				Opener:     oldconfig.Opener,
+				History:    oldconfig.History,
+				Bookmarks:  oldconfig.Bookmarks,
+				Loglevel:   oldconfig.Loglevel,
+				Remotepath: "",
 			},
 		},
 	}
 }
 
-// saveNewConfig writes a new config to disk or generates an error.
-func saveNewConfig(config *GlobalConfiguration, fp string) error {
-	fd, err := os.Create(fp)
+// writeConfigFile atomically replaces the configuration file fp with
+// contents: readers see either the old or the new configuration.
+func writeConfigFile(fp string, contents []byte) error {
+	mode := os.FileMode(0644)
+	if fi, err := os.Stat(fp); err == nil {
+		mode = fi.Mode().Perm()
+	}
+
+	if err := os.MkdirAll(filepath.Dir(fp), 0700); err != nil {
+		return fmt.Errorf("can't make config directory: %v", err)
+	}
+	fd, err := os.CreateTemp(filepath.Dir(fp), filepath.Base(fp)+".tmp*")
 	if err != nil {
+		return fmt.Errorf("can't make temporary config file: %v", err)
+	}
+	tmp := fd.Name()
+	if _, err := fd.Write(contents); err != nil {
+		fd.Close()
+		os.Remove(tmp)
+		return fmt.Errorf("can't write temporary config file: %v", err)
+	}
+	if err := fd.Sync(); err != nil {
+		fd.Close()
+		os.Remove(tmp)
+		return fmt.Errorf("can't sync temporary config file: %v", err)
+	}
+	if err := fd.Close(); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("can't close temporary config file: %v", err)
+	}
+	if err := os.Chmod(tmp, mode); err != nil {
+		os.Remove(tmp)
 		return err
 	}
-	defer fd.Close()
+	if err := os.Rename(tmp, fp); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("can't replace config file %s: %v", fp, err)
+	}
+	return nil
+}
 
-	coder := json.NewEncoder(fd)
-	coder.SetIndent("", "	")
-	if err := coder.Encode(config); err != nil {
+// saveNewConfig writes a new config to disk or generates an error. The
+// caller should hold the lock from lockConfig.
+func saveNewConfig(config *GlobalConfiguration, fp string) error {
+	b, err := json.MarshalIndent(config, "", "	")
+	if err != nil {
 		return err
 	}
-	return nil
+	return writeConfigFile(fp, append(b, '\n'))
 }
 
 // updateNewConfiguration will update config's embedded newconfig based
@@ -171,38 +346,58 @@ func saveNewConfig(config *GlobalConfiguration, fp string) error {
 func (config *Configuration) pushConfigIntoNew() {
 	nc := config.newconfig
 
-	proj := nc.Projects[nc.Currentproject]
+	proj, ok := nc.Projects[config.project]
+	if !ok {
+		// Removed since config was read.
+		proj = &Project{}
+		nc.Projects[config.project] = proj
+	}
 
 	proj.Host = config.Hostname
 	proj.Indexpath = config.Indexpath
 	proj.Remote = config.Connect
 	proj.Prefixes = config.Prefixes
+	proj.Git = config.Git
+	proj.Rewrites = config.Rewrites
+	proj.Mount = config.Mount
+	proj.Opener = config.Opener
+	proj.History = config.History
+	proj.Bookmarks = config.Bookmarks
+	proj.Loglevel = config.Loglevel
 }
 
-// TODO(rjk): I'm not going to worry about simultaneous mutation.
-// This code does not force conversion to the new format. I want
-// to do this manually via a top-level leap command to avoid
-// surprising myself.
+// SaveConfiguration writes config to the configuration file fp in the
+// format that config was read in. It holds the lock on fp while doing so.
+// This code does not force conversion to the new format. I want to do
+// this manually via a top-level leap command to avoid surprising myself.
 func SaveConfiguration(config *Configuration, fp string) error {
-	// We might have a new style config. If we do, we update that
-	// instead. Otherwise, we write out the old way.
-
-	fd, err := os.Create(fp)
+	unlock, err := lockConfig(fp)
 	if err != nil {
-		return fmt.Errorf("can't open file for config because %v", err)
+		return err
 	}
-	defer fd.Close()
+	defer unlock()
+	return saveConfiguration(config, fp)
+}
 
-	if _, err := getNewConfig(fd); err == nil {
-		// We have a new configuration so update that instead.
-		config.pushConfigIntoNew()
-		return saveNewConfig(config.newconfig, fp)
+// saveConfiguration is SaveConfiguration for callers holding the lock.
+func saveConfiguration(config *Configuration, fp string) error {
+	if config.newconfig == nil {
+		// We have a old configuration. So update that.
+		b, err := json.Marshal(config)
+		if err != nil {
+			return err
+		}
+		return writeConfigFile(fp, append(b, '\n'))
 	}
 
-	// We have a old configuration. So update that.
-	coder := json.NewEncoder(fd)
-	if err := coder.Encode(config); err != nil {
-		return err
+	// Changes to the other projects since config was read are kept by
+	// only updating config's project in the current configuration.
+	if b, err := os.ReadFile(fp); err == nil {
+		if gc, _, err := decodeConfig(b); err == nil && gc != nil {
+			gc.Currentproject = config.newconfig.Currentproject
+			config.newconfig = gc
+		}
 	}
-	return nil
+	config.pushConfigIntoNew()
+	return saveNewConfig(config.newconfig, fp)
 }
@@ -1,10 +1,14 @@
 package base
 
 import (
+	"bytes"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"reflect"
+	"strings"
+	"sync"
 	"testing"
 )
 
@@ -112,6 +116,7 @@ func TestUpdateNewConfig(t *testing.T) {
 	name := fd.Name()
 	fd.Close()
 	defer os.Remove(name)
+	defer os.Remove(name + ".lock")
 
 	// Copy leaprc_new to temp file
 	fp := filepath.Join("testdata", "leaprc_new")
@@ -161,4 +166,379 @@ func TestUpdateNewConfig(t *testing.T) {
 	if got, want := conf.Prefixes, econf.Prefixes; !reflect.DeepEqual(got, want) {
 		t.Errorf("%s wrong got %v want %v", "Prefixes", got, want)
 	}
+
+	// Saving keeps the format that was read.
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatalf("can't read modified config because %v", err)
+	}
+	if _, legacy, err := decodeConfig(b); err != nil || legacy != nil {
+		t.Errorf("saved config isn't a new config: legacy %v, err %v", legacy, err)
+	}
+}
+
+func TestSaveLegacyConfig(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "leaprc")
+	contents, err := ioutil.ReadFile(filepath.Join("testdata", "leaprc_original"))
+	if err != nil {
+		t.Fatalf("can't read starter config because %v", err)
+	}
+	if err := ioutil.WriteFile(name, contents, 0600); err != nil {
+		t.Fatalf("can't write starter config because %v", err)
+	}
+
+	conf, err := GetConfiguration(name)
+	if err != nil {
+		t.Fatalf("can't read starter config because %v", err)
+	}
+	conf.Hostname = "pinkelephant"
+	if err := SaveConfiguration(conf, name); err != nil {
+		t.Fatalf("can't save config because %v", err)
+	}
+
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatalf("can't read saved config because %v", err)
+	}
+	gc, legacy, err := decodeConfig(b)
+	if err != nil || gc != nil {
+		t.Fatalf("saved config isn't a legacy config: new %v, err %v", gc, err)
+	}
+	if got, want := legacy.Hostname, "pinkelephant"; got != want {
+		t.Errorf("Hostname got %v want %v", got, want)
+	}
+
+	fi, err := os.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := fi.Mode().Perm(), os.FileMode(0600); got != want {
+		t.Errorf("mode got %v want %v", got, want)
+	}
+}
+
+func TestConcurrentSaveConfiguration(t *testing.T) {
+	const n = 8
+	dir := t.TempDir()
+	name := filepath.Join(dir, "leaprc")
+
+	gc := &GlobalConfiguration{
+		Version:        ConfigVersion,
+		Currentproject: "p0",
+		Projects:       map[string]*Project{},
+	}
+	for i := 0; i < n; i++ {
+		gc.Projects[fmt.Sprintf("p%d", i)] = &Project{Prefixes: []string{}}
+	}
+	if err := saveNewConfig(gc, name); err != nil {
+		t.Fatalf("can't write starter config because %v", err)
+	}
+
+	// Every writer reads before any of them writes so each save must keep
+	// the others' changes.
+	confs := make([]*Configuration, n)
+	for i := range confs {
+		conf, err := GetConfiguration(name)
+		if err != nil {
+			t.Fatalf("can't read starter config because %v", err)
+		}
+		confs[i], err = conf.GetNewConfiguration().ProjectConfiguration(fmt.Sprintf("p%d", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		confs[i].Indexpath = fmt.Sprintf("/index/%d", i)
+	}
+
+	done := make(chan struct{})
+	readerr := make(chan error, 1)
+	go func() {
+		defer close(readerr)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			if _, err := GetConfiguration(name); err != nil {
+				readerr <- err
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for _, conf := range confs {
+		wg.Add(1)
+		go func(conf *Configuration) {
+			defer wg.Done()
+			if err := SaveConfiguration(conf, name); err != nil {
+				t.Errorf("can't save %s because %v", conf.Project(), err)
+			}
+		}(conf)
+	}
+	wg.Wait()
+	close(done)
+	if err := <-readerr; err != nil {
+		t.Errorf("reader saw a bad config: %v", err)
+	}
+
+	conf, err := GetConfiguration(name)
+	if err != nil {
+		t.Fatalf("can't read saved config because %v", err)
+	}
+	ngc := conf.GetNewConfiguration()
+	for i := 0; i < n; i++ {
+		p := fmt.Sprintf("p%d", i)
+		if got, want := ngc.Projects[p].Indexpath, fmt.Sprintf("/index/%d", i); got != want {
+			t.Errorf("%s Indexpath got %q want %q", p, got, want)
+		}
+	}
+
+	ents, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range ents {
+		if e.Name() != "leaprc" && e.Name() != "leaprc.lock" {
+			t.Errorf("left behind %s", e.Name())
+		}
+	}
+}
+
+func TestAllIndexes(t *testing.T) {
+	conf, err := GetConfiguration(filepath.Join("testdata", "leaprc_indexes"))
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	want := []Index{
+		{
+			Indexpath:  "/home/gopher/.csearchindex",
+			Prefixes:   []string{"/home/gopher/src"},
+			Remotepath: "/remote/gopher/.csearchindex",
+		},
+		{
+			Indexpath: "/home/gopher/.third_party_index",
+			Prefixes:  []string{"/home/gopher/third_party"},
+		},
+	}
+	if got := conf.AllIndexes(); !reflect.DeepEqual(got, want) {
+		t.Errorf("AllIndexes got %#v want %#v", got, want)
+	}
+
+	orig, err := GetConfiguration(filepath.Join("testdata", "leaprc_original"))
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if got, want := len(orig.AllIndexes()), 1; got != want {
+		t.Errorf("AllIndexes of a legacy config got %d indexes want %d", got, want)
+	}
+}
+
+func TestProjectConfiguration(t *testing.T) {
+	gc := &GlobalConfiguration{
+		Version:        1,
+		Currentproject: "b",
+		Projects: map[string]*Project{
+			"b": {Host: "bhost", Indexpath: "/b/index", Remotepath: "/remote/b/index"},
+			"a": {Host: "ahost", Indexpath: "/a/index", Remote: true, Remotepath: "/remote/a/index"},
+		},
+	}
+
+	if got, want := gc.ProjectNames(), []string{"a", "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ProjectNames got %v want %v", got, want)
+	}
+
+	conf, err := gc.ProjectConfiguration("a")
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if got, want := conf.Hostname, "ahost"; got != want {
+		t.Errorf("Hostname got %v want %v", got, want)
+	}
+	if got, want := conf.Project(), "a"; got != want {
+		t.Errorf("Project got %v want %v", got, want)
+	}
+	if got, want := conf.AllIndexes()[0].Remotepath, "/remote/a/index"; got != want {
+		t.Errorf("Remotepath got %v want %v", got, want)
+	}
+
+	if _, err := gc.ProjectConfiguration("c"); err == nil {
+		t.Errorf("expected an error for a missing project")
+	}
+}
+
+func TestRewritePath(t *testing.T) {
+	rules := []Rewrite{
+		{From: "/home/build/src", To: "/n/remote/src"},
+		{From: "/home/build/src/third_party/", To: "/n/tp/"},
+		{From: "/home/build/out", To: "/n/out"},
+	}
+
+	for _, tv := range []struct {
+		in   string
+		want string
+	}{
+		{"/home/build/src/a/b.go", "/n/remote/src/a/b.go"},
+		{"/home/build/src", "/n/remote/src"},
+		{"/home/build/src/third_party/x.c", "/n/tp/x.c"},
+		{"/home/build/srcs/a.go", "/home/build/srcs/a.go"},
+		{"/home/build/out/b.go:12", "/n/out/b.go:12"},
+		{"/elsewhere/a.go", "/elsewhere/a.go"},
+	} {
+		if got := RewritePath(rules, tv.in); got != tv.want {
+			t.Errorf("RewritePath(%q) got %q want %q", tv.in, got, tv.want)
+		}
+	}
+
+	if got, want := RewritePath(nil, "/a/b"), "/a/b"; got != want {
+		t.Errorf("RewritePath with no rules got %q want %q", got, want)
+	}
+}
+
+func TestAllRewrites(t *testing.T) {
+	config := &Configuration{
+		Rewrites: []Rewrite{{From: "/home/build/out", To: "/n/out"}},
+		Mount:    "/n/build",
+	}
+	rules := config.AllRewrites()
+
+	for _, tv := range []struct {
+		in   string
+		want string
+	}{
+		{"/home/build/src/a.go", "/n/build/home/build/src/a.go"},
+		{"/home/build/out/b.go", "/n/out/b.go"},
+	} {
+		if got := RewritePath(rules, tv.in); got != tv.want {
+			t.Errorf("RewritePath(%q) got %q want %q", tv.in, got, tv.want)
+		}
+	}
+
+	if got := (&Configuration{}).AllRewrites(); len(got) != 0 {
+		t.Errorf("unmounted project got rewrites %v", got)
+	}
+}
+
+func TestParseBookmark(t *testing.T) {
+	for _, tv := range []struct {
+		in   string
+		want Bookmark
+	}{
+		{"/a/b.go", Bookmark{Path: "/a/b.go"}},
+		{"/a/b.go:12", Bookmark{Path: "/a/b.go", Line: 12}},
+		{"/a/b.go:/func Main/", Bookmark{Path: "/a/b.go", Regexp: "func Main"}},
+		{"/a/b.go:/a/b/", Bookmark{Path: "/a/b.go", Regexp: "a/b"}},
+		{"/a/../c.go:3", Bookmark{Path: "/c.go", Line: 3}},
+	} {
+		got, err := ParseBookmark(tv.in)
+		if err != nil {
+			t.Errorf("ParseBookmark(%q) unexpected error: %v", tv.in, err)
+			continue
+		}
+		if got != tv.want {
+			t.Errorf("ParseBookmark(%q) got %#v want %#v", tv.in, got, tv.want)
+		}
+	}
+
+	for _, bad := range []string{"", ":12", "/a/b.go:/(/"} {
+		if _, err := ParseBookmark(bad); err == nil {
+			t.Errorf("ParseBookmark(%q) expected an error", bad)
+		}
+	}
+}
+
+func TestMigrateV1(t *testing.T) {
+	conf, err := GetConfiguration(filepath.Join("testdata", "leaprc_v1_fix"))
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	gc := conf.GetNewConfiguration()
+	if gc.Version != ConfigVersion {
+		t.Errorf("got version %d want %d", gc.Version, ConfigVersion)
+	}
+	p := gc.Projects["default"]
+	if p.Remoteproject != "" || p.Remotepath != "" {
+		t.Errorf("placeholders not cleared: %#v", p)
+	}
+
+	errs := gc.Validate()
+	if len(errs) != 1 {
+		t.Fatalf("got %v want one error", errs)
+	}
+	if got, want := errs[0].Error(), `project default: indexpath: remote project index "/Users/gopher/.csearchindex" has no remote path`; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+}
+
+func TestUpgradeLegacy(t *testing.T) {
+	conf, err := GetConfiguration(filepath.Join("testdata", "leaprc_original"))
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	gc, err := upgradeLegacy(conf)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if gc.Version != ConfigVersion {
+		t.Errorf("got version %d want %d", gc.Version, ConfigVersion)
+	}
+	if errs := gc.Validate(); len(errs) != 0 {
+		t.Errorf("unexpected problems %v", errs)
+	}
+}
+
+func TestGetConfigurationErrors(t *testing.T) {
+	for _, tv := range []struct {
+		name string
+		want string
+	}{
+		{"leaprc_future", "newer than version 2"},
+		{"leaprc_broken", "isn't valid JSON"},
+	} {
+		_, err := GetConfiguration(filepath.Join("testdata", tv.name))
+		if err == nil || !strings.Contains(err.Error(), tv.want) {
+			t.Errorf("%s got error %v want one containing %q", tv.name, err, tv.want)
+		}
+	}
+}
+
+func TestCheckConfiguration(t *testing.T) {
+	fp := filepath.Join("testdata", "leaprc_invalid")
+	before, err := os.ReadFile(fp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errs, err := CheckConfiguration(fp)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	got := make([]string, 0, len(errs))
+	for _, e := range errs {
+		got = append(got, e.Error())
+	}
+	want := []string{
+		`currentproject: unknown project "missing"`,
+		`project alpha: host: remote project has no host`,
+		`project alpha: prefixes: prefix "/home/gopher/src/github.com" is inside prefix "/home/gopher/src"`,
+		`project alpha: prefixes: prefix "src" is not absolute`,
+		`project alpha: indexes: remote project index "/home/gopher/.other" has no remote path`,
+		"project alpha: bookmarks: bad: bad bookmark regexp \"(\": error parsing regexp: missing closing ): `(`",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	after, err := os.ReadFile(fp)
+	if err != nil || !bytes.Equal(before, after) {
+		t.Errorf("CheckConfiguration changed %s", fp)
+	}
+
+	if errs, err := CheckConfiguration(filepath.Join("testdata", "leaprc_new")); err != nil || len(errs) != 0 {
+		t.Errorf("valid configuration got %v, %v", errs, err)
+	}
+	if _, err := CheckConfiguration(filepath.Join("testdata", "leaprc_broken")); err == nil {
+		t.Errorf("expected an error for a broken configuration")
+	}
 }
@@ -0,0 +1,357 @@
+package base
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/google/codesearch/index"
+)
+
+// SystemFilepath is the configuration file shared by every user.
+const SystemFilepath = "/etc/leaprc"
+
+// DirectoryFilename is the name of the configuration files found by
+// walking up from the working directory.
+const DirectoryFilename = ".leaprc"
+
+// directoryFields are the project fields that a directory configuration
+// can set. It may come from a cloned repository so can't choose commands
+// to run, hosts to query or paths to write.
+var directoryFields = map[string]bool{
+	"prefixes": true,
+	"git":      true,
+	"history":  true,
+	"loglevel": true,
+}
+
+// EnvPrefix starts the names of the environment variables that override
+// the configuration. LEAP_PROJECT selects the current project and
+// LEAP_<KEY> overrides the setting <key> (as in leap config set) of the
+// current project. LEAP_PREFIXES is a list of paths like PATH.
+const EnvPrefix = "LEAP_"
+
+// The layers of a configuration from lowest to highest precedence.
+const (
+	LayerSystem    = "system"
+	LayerUser      = "user"
+	LayerDirectory = "directory"
+	LayerEnv       = "env"
+	LayerFlags     = "flags"
+)
+
+// Layers are the sources of a configuration. Files only need to set the
+// values that they override.
+type Layers struct {
+	System    string
+	User      string
+	Directory string
+	Environ   []string
+	// Useproject is the project selected by -useproject.
+	Useproject string
+}
+
+// layersFor returns the Layers of leap with the user configuration file
+// fp.
+func layersFor(fp string) Layers {
+	l := Layers{
+		System:     SystemFilepath,
+		User:       fp,
+		Environ:    os.Environ(),
+		Useproject: *useproject,
+	}
+	if wd, err := os.Getwd(); err == nil {
+		l.Directory = findDirectoryConfig(wd, fp)
+	}
+	return l
+}
+
+// findDirectoryConfig returns the closest DirectoryFilename in dir or its
+// parents that isn't the user configuration file user. It returns "" if
+// there is none.
+func findDirectoryConfig(dir, user string) string {
+	ufi, _ := os.Stat(user)
+	for {
+		fp := filepath.Join(dir, DirectoryFilename)
+		if fi, err := os.Stat(fp); err == nil && !fi.IsDir() && (ufi == nil || !os.SameFile(fi, ufi)) {
+			return fp
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// Key names a value of a configuration: the current project or a field
+// of a project.
+type Key struct {
+	// Project is "" for the current project.
+	Project string
+	Field   string
+}
+
+var currentKey = Key{Field: "currentproject"}
+
+func (k Key) String() string {
+	if k.Project == "" {
+		return k.Field
+	}
+	return "projects." + k.Project + "." + k.Field
+}
+
+// EffectiveConfiguration is a configuration merged from its Layers.
+type EffectiveConfiguration struct {
+	*GlobalConfiguration
+	// Source is the layer that set each value.
+	Source map[Key]string
+	// Files are the layer and path of each configuration file read.
+	Files []string
+
+	values   map[Key]json.RawMessage
+	projects map[string]bool
+	// legacy is set when the user file is a legacy configuration.
+	legacy bool
+}
+
+func (ec *EffectiveConfiguration) set(layer string, k Key, v json.RawMessage) {
+	if k.Project != "" {
+		ec.projects[k.Project] = true
+	}
+	ec.values[k] = v
+	ec.Source[k] = layer
+}
+
+// Load merges the layers. A layer overrides the values set by the
+// layers before it.
+func (l Layers) Load() (*EffectiveConfiguration, error) {
+	ec := &EffectiveConfiguration{
+		Source:   make(map[Key]string),
+		Files:    make([]string, 0),
+		values:   make(map[Key]json.RawMessage),
+		projects: make(map[string]bool),
+	}
+	for _, f := range []struct{ layer, fp string }{
+		{LayerSystem, l.System},
+		{LayerUser, l.User},
+		{LayerDirectory, l.Directory},
+	} {
+		if f.fp == "" {
+			continue
+		}
+		legacy, err := ec.addFile(f.layer, f.fp)
+		if err != nil {
+			return nil, err
+		}
+		if f.layer == LayerUser {
+			ec.legacy = legacy
+		}
+	}
+	if err := ec.addEnv(l.Environ, l.Useproject); err != nil {
+		return nil, err
+	}
+
+	gc, err := ec.merge()
+	if err != nil {
+		return nil, err
+	}
+	ec.GlobalConfiguration = gc
+	return ec, nil
+}
+
+// addFile adds the values set by the configuration file fp if it exists.
+// Every value of a legacy configuration is set. It reports if fp is a
+// legacy configuration.
+func (ec *EffectiveConfiguration) addFile(layer, fp string) (bool, error) {
+	b, err := os.ReadFile(fp)
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("can't read config file %s because %v", fp, err)
+	}
+	gc, legacy, err := decodeConfig(b)
+	if err != nil {
+		return false, fmt.Errorf("bad config file %s: %v", fp, err)
+	}
+
+	// The fields present in the file. gc has them all.
+	var present struct {
+		Currentproject *string                               `json:"currentproject"`
+		Projects       map[string]map[string]json.RawMessage `json:"projects"`
+	}
+	if legacy != nil {
+		if legacy.Indexpath == "" {
+			legacy.Indexpath = index.File()
+		}
+		if gc, err = upgradeLegacy(legacy); err != nil {
+			return false, fmt.Errorf("can't upgrade config file %s: %v", fp, err)
+		}
+	} else if err := json.Unmarshal(b, &present); err != nil {
+		return false, fmt.Errorf("bad config file %s: %v", fp, err)
+	}
+	ec.Files = append(ec.Files, layer+" "+fp)
+
+	if legacy != nil || present.Currentproject != nil {
+		v, _ := json.Marshal(gc.Currentproject)
+		ec.set(layer, currentKey, v)
+	}
+	for name, p := range gc.Projects {
+		ec.projects[name] = true
+		b, err := json.Marshal(p)
+		if err != nil {
+			return false, err
+		}
+		fields := make(map[string]json.RawMessage)
+		if err := json.Unmarshal(b, &fields); err != nil {
+			return false, err
+		}
+		for f, v := range fields {
+			if _, ok := present.Projects[name][f]; !ok && legacy == nil {
+				continue
+			}
+			if layer == LayerDirectory && !directoryFields[f] {
+				slog.Warn("ignoring setting in directory configuration", "file", fp, "key", Key{name, f}.String())
+				continue
+			}
+			ec.set(layer, Key{name, f}, v)
+		}
+	}
+	return legacy != nil, nil
+}
+
+// addEnv adds the values set by the environment variables in environ and
+// then the project selected by -useproject.
+func (ec *EffectiveConfiguration) addEnv(environ []string, useproject string) error {
+	env := make(map[string]string)
+	for _, kv := range environ {
+		if k, v, ok := strings.Cut(kv, "="); ok && strings.HasPrefix(k, EnvPrefix) && v != "" {
+			env[k] = v
+		}
+	}
+
+	if p, ok := env[EnvPrefix+"PROJECT"]; ok {
+		v, _ := json.Marshal(p)
+		ec.set(LayerEnv, currentKey, v)
+	}
+	if useproject != "" {
+		v, _ := json.Marshal(useproject)
+		ec.set(LayerFlags, currentKey, v)
+	}
+
+	current := ""
+	if v, ok := ec.values[currentKey]; ok {
+		if err := json.Unmarshal(v, &current); err != nil {
+			return err
+		}
+	}
+	for _, key := range settingNames() {
+		s, ok := env[EnvPrefix+strings.ToUpper(key)]
+		if !ok {
+			continue
+		}
+		if current == "" {
+			// Only the environment configures leap.
+			current = "default"
+			v, _ := json.Marshal(current)
+			ec.set(LayerEnv, currentKey, v)
+		}
+		p := new(Project)
+		if key == "prefixes" {
+			p.Prefixes = filepath.SplitList(s)
+		} else if err := settings[key].set(p, s); err != nil {
+			return fmt.Errorf("bad %s%s: %v", EnvPrefix, strings.ToUpper(key), err)
+		}
+		v, err := json.Marshal(settings[key].value(p))
+		if err != nil {
+			return err
+		}
+		ec.set(LayerEnv, Key{current, key}, v)
+	}
+	return nil
+}
+
+// merge makes the GlobalConfiguration with the values of ec.
+func (ec *EffectiveConfiguration) merge() (*GlobalConfiguration, error) {
+	projects := make(map[string]map[string]json.RawMessage)
+	for name := range ec.projects {
+		projects[name] = make(map[string]json.RawMessage)
+	}
+	merged := map[string]interface{}{
+		"version":  ConfigVersion,
+		"projects": projects,
+	}
+	for k, v := range ec.values {
+		if k == currentKey {
+			merged["currentproject"] = v
+			continue
+		}
+		projects[k.Project][k.Field] = v
+	}
+
+	b, err := json.Marshal(merged)
+	if err != nil {
+		return nil, err
+	}
+	gc := new(GlobalConfiguration)
+	if err := json.Unmarshal(b, gc); err != nil {
+		return nil, fmt.Errorf("can't merge configurations: %v", err)
+	}
+	return gc, nil
+}
+
+// onlyUser reports if every value came from the user file.
+func (ec *EffectiveConfiguration) onlyUser() bool {
+	for _, l := range ec.Source {
+		if l != LayerUser {
+			return false
+		}
+	}
+	return true
+}
+
+// Print writes every value of ec and the layer that set it to w.
+func (ec *EffectiveConfiguration) Print(w io.Writer) {
+	for _, f := range ec.Files {
+		fmt.Fprintf(w, "# %s\n", f)
+	}
+	keys := make([]Key, 0, len(ec.values))
+	for k := range ec.values {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Project != keys[j].Project {
+			return keys[i].Project < keys[j].Project
+		}
+		return keys[i].Field < keys[j].Field
+	})
+	for _, k := range keys {
+		fmt.Fprintf(w, "%s = %s	# %s\n", k, ec.values[k], ec.Source[k])
+	}
+}
+
+// configuration returns the configuration of the current project merged
+// from l. It's GetConfiguration(l.User) when only the user file
+// configures leap so legacy configurations work as before.
+func (l Layers) configuration() (*Configuration, error) {
+	ec, err := l.Load()
+	if err != nil {
+		return nil, err
+	}
+	if ec.onlyUser() {
+		return GetConfiguration(l.User)
+	}
+	return ec.getLegacyConfiguration()
+}
+
+// LoadConfiguration returns the configuration of the current project
+// merged from every layer of leap's configuration. It's for reading:
+// save changes to the user file read with GetConfiguration.
+func LoadConfiguration(test bool) (*Configuration, error) {
+	return layersFor(Filepath(test)).configuration()
+}
@@ -0,0 +1,209 @@
+package base
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writeFile(t *testing.T, fp, contents string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(fp), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(fp, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLayersLoad(t *testing.T) {
+	dir := t.TempDir()
+	l := Layers{
+		System:    filepath.Join(dir, "etc", "leaprc"),
+		User:      filepath.Join(dir, "home", ".leaprc"),
+		Directory: filepath.Join(dir, "home", "src", "web", ".leaprc"),
+		Environ:   []string{"LEAP_GIT=true", "LEAP_CONTEXT=/x.go", "LEAP_MOUNT=", "HOME=/home"},
+	}
+	writeFile(t, l.System, `{"version": 2, "projects": {"web": {"host": "build", "opener": "plumb"}}}`)
+	writeFile(t, l.User, `{
+	"version": 2,
+	"currentproject": "api",
+	"projects": {
+		"api": {"host": "", "indexpath": "/home/api.index", "prefixes": ["/home/src/api"]},
+		"web": {"host": "mybuild", "indexpath": "/home/web.index", "remote": true, "prefixes": ["/home/src/web"], "remotepath": "/r/web.index"}
+	}
+}`)
+	writeFile(t, l.Directory, `{"version": 2, "currentproject": "web", "projects": {"web": {"history": true}}}`)
+
+	ec, err := l.Load()
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if got, want := ec.Currentproject, "web"; got != want {
+		t.Errorf("Currentproject got %q want %q", got, want)
+	}
+	want := Project{
+		Host:       "mybuild",
+		Indexpath:  "/home/web.index",
+		Remote:     true,
+		Prefixes:   []string{"/home/src/web"},
+		Remotepath: "/r/web.index",
+		Git:        true,
+		History:    true,
+		Opener:     "plumb",
+	}
+	if got := *ec.Projects["web"]; !reflect.DeepEqual(got, want) {
+		t.Errorf("web got %#v want %#v", got, want)
+	}
+	if got, want := ec.Projects["api"].Indexpath, "/home/api.index"; got != want {
+		t.Errorf("api Indexpath got %q want %q", got, want)
+	}
+
+	for k, want := range map[Key]string{
+		currentKey:          LayerDirectory,
+		{"web", "opener"}:   LayerSystem,
+		{"web", "host"}:     LayerUser,
+		{"web", "history"}:  LayerDirectory,
+		{"web", "git"}:      LayerEnv,
+		{"api", "prefixes"}: LayerUser,
+	} {
+		if got := ec.Source[k]; got != want {
+			t.Errorf("Source[%v] got %q want %q", k, got, want)
+		}
+	}
+
+	out := new(bytes.Buffer)
+	ec.Print(out)
+	for _, line := range []string{
+		"# system " + l.System + "\n",
+		"currentproject = \"web\"\t# directory\n",
+		"projects.web.git = true\t# env\n",
+		"projects.web.host = \"mybuild\"\t# user\n",
+	} {
+		if !strings.Contains(out.String(), line) {
+			t.Errorf("Print output %q is missing %q", out.String(), line)
+		}
+	}
+
+	// Flags select the project ahead of the environment.
+	l.Environ = append(l.Environ, "LEAP_PROJECT=web", "LEAP_HOST=envhost")
+	l.Useproject = "api"
+	ec, err = l.Load()
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if got, want := ec.Currentproject, "api"; got != want {
+		t.Errorf("Currentproject got %q want %q", got, want)
+	}
+	if got, want := ec.Source[currentKey], LayerFlags; got != want {
+		t.Errorf("Source of currentproject got %q want %q", got, want)
+	}
+	if got, want := ec.Projects["api"].Host, "envhost"; got != want {
+		t.Errorf("api Host got %q want %q", got, want)
+	}
+
+	l.Environ = []string{"LEAP_REMOTE=sometimes"}
+	if _, err := l.Load(); err == nil {
+		t.Errorf("expected an error for a bad LEAP_REMOTE")
+	}
+}
+
+func TestLayersDirectoryFields(t *testing.T) {
+	dir := t.TempDir()
+	l := Layers{
+		User:      filepath.Join(dir, "home", ".leaprc"),
+		Directory: filepath.Join(dir, "home", "src", "clone", ".leaprc"),
+	}
+	writeFile(t, l.User, `{"version": 2, "currentproject": "web", "projects": {"web": {"host": "mybuild", "opener": "acme"}}}`)
+	writeFile(t, l.Directory, `{"version": 2, "projects": {"web": {
+		"opener": "Template:rm -rf {{.Path}}",
+		"host": "evil.example.com",
+		"indexpath": "/home/.profile",
+		"prefixes": ["/home/src/clone"]
+	}}}`)
+
+	ec, err := l.Load()
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	p := ec.Projects["web"]
+	if got, want := p.Opener, "acme"; got != want {
+		t.Errorf("Opener got %q want %q", got, want)
+	}
+	if got, want := p.Host, "mybuild"; got != want {
+		t.Errorf("Host got %q want %q", got, want)
+	}
+	if got := p.Indexpath; got != "" {
+		t.Errorf("Indexpath got %q want none", got)
+	}
+	if got, want := p.Prefixes, []string{"/home/src/clone"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Prefixes got %v want %v", got, want)
+	}
+}
+
+func TestLayersConfiguration(t *testing.T) {
+	dir := t.TempDir()
+	l := Layers{
+		System: filepath.Join(dir, "missing"),
+		User:   filepath.Join("testdata", "leaprc_original"),
+	}
+
+	// Only a legacy user file is as before.
+	conf, err := l.configuration()
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if conf.GetNewConfiguration() != nil {
+		t.Errorf("legacy configuration became a new one")
+	}
+
+	// Otherwise legacy configurations are upgraded.
+	l.Environ = []string{"LEAP_HOST=envhost"}
+	conf, err = l.configuration()
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if got, want := conf.Project(), "default"; got != want {
+		t.Errorf("Project got %q want %q", got, want)
+	}
+	if got, want := conf.Hostname, "envhost"; got != want {
+		t.Errorf("Hostname got %q want %q", got, want)
+	}
+	if got, want := conf.Indexpath, "/Users/rjkroege/.csearchindex"; got != want {
+		t.Errorf("Indexpath got %q want %q", got, want)
+	}
+
+	// The environment alone can configure leap.
+	l.User = filepath.Join(dir, "missing")
+	l.Environ = []string{"LEAP_INDEXPATH=/tmp/index", "LEAP_PREFIXES=/a" + string(os.PathListSeparator) + "/b"}
+	conf, err = l.configuration()
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if got, want := conf.Prefixes, []string{"/a", "/b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Prefixes got %v want %v", got, want)
+	}
+}
+
+func TestFindDirectoryConfig(t *testing.T) {
+	dir := t.TempDir()
+	user := filepath.Join(dir, DirectoryFilename)
+	writeFile(t, user, "{}")
+	project := filepath.Join(dir, "src", "web", DirectoryFilename)
+	writeFile(t, project, "{}")
+	deep := filepath.Join(dir, "src", "web", "pkg", "server")
+	if err := os.MkdirAll(deep, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := findDirectoryConfig(deep, user), project; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+	// The user file isn't a directory configuration.
+	if got := findDirectoryConfig(filepath.Join(dir, "src"), user); got != "" {
+		t.Errorf("got %q want none", got)
+	}
+}
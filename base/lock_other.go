@@ -0,0 +1,9 @@
+//go:build !unix
+
+package base
+
+// lockConfig doesn't lock on systems without flock. Writes are still
+// atomic.
+func lockConfig(fp string) (func(), error) {
+	return func() {}, nil
+}
@@ -0,0 +1,35 @@
+//go:build unix
+
+package base
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// lockConfig takes an advisory lock on the configuration file fp,
+// waiting for any other holder. The lock is on a separate file because
+// writes replace fp. It's released by calling the returned function or
+// by exiting.
+func lockConfig(fp string) (func(), error) {
+	if err := os.MkdirAll(filepath.Dir(fp), 0700); err != nil {
+		return nil, fmt.Errorf("can't make config directory: %v", err)
+	}
+	fd, err := os.OpenFile(fp+".lock", os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("can't open lock for %s: %v", fp, err)
+	}
+	for {
+		err = syscall.Flock(int(fd.Fd()), syscall.LOCK_EX)
+		if err != syscall.EINTR {
+			break
+		}
+	}
+	if err != nil {
+		fd.Close()
+		return nil, fmt.Errorf("can't lock %s: %v", fp, err)
+	}
+	return func() { fd.Close() }, nil
+}
@@ -1,22 +1,61 @@
 package base
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
+	"io"
 	"log"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"strings"
 	"time"
 )
 
+// TraceKey is the attribute of the trace ID in log records. Each query
+// has a trace ID that's sent to the server in the RPC args so that the
+// client and server records of a query can be matched.
+const TraceKey = "trace"
+
+// logLevel is the level of the records logged: records at lower levels
+// are dropped.
+var logLevel = new(slog.LevelVar)
+
+// LogTo makes slog (and so the log package) write records to w.
+func LogTo(w io.Writer) {
+	slog.SetDefault(slog.New(slog.NewTextHandler(w, &slog.HandlerOptions{Level: logLevel})))
+}
+
+// SetLogLevel sets the level of the records logged from one of debug,
+// info, warn or error. Empty is info.
+func SetLogLevel(level string) error {
+	if level == "" {
+		logLevel.Set(slog.LevelInfo)
+		return nil
+	}
+	if err := logLevel.UnmarshalText([]byte(level)); err != nil {
+		return fmt.Errorf("bad log level %q: %v", level, err)
+	}
+	return nil
+}
+
+// NewTraceID returns a random ID for a query.
+func NewTraceID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
 // SetupLogging configures the Go logger to write log messages to the "standard"
-// place on MacOS. Logs for what.
-// TODO(rjk): Generalize to more than Darwin
+// place: LogDir(what). Logs for what.
 func SetupLogging(what string) error {
 	// Based on how Kopia organizes its logs.
 	logFileName := fmt.Sprintf("%v-%v-%v%v", what, time.Now().Format("20060102-150405"), os.Getpid(), ".log")
 
-	logDir := filepath.Join(os.Getenv("HOME"), "Library", "Logs", what)
+	logDir := LogDir(what)
 
 	if err := os.MkdirAll(logDir, 0755); err != nil {
 		return fmt.Errorf("can't make log directory %s: %v", logDir, err)
@@ -28,7 +67,7 @@ func SetupLogging(what string) error {
 		return fmt.Errorf("can't create log file %s: %v", path, err)
 	}
 
-	log.SetOutput(fd)
+	LogTo(fd)
 	return nil
 }
 
@@ -43,7 +82,7 @@ func RollLogs(what string) {
 
 func rollOneLog(target string, older time.Duration) error {
 	now := time.Now()
-	logDir := filepath.Join(os.Getenv("HOME"), "Library", "Logs", target)
+	logDir := LogDir(target)
 	if err := filepath.Walk(logDir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
@@ -0,0 +1,52 @@
+package base
+
+import (
+	"bytes"
+	"log/slog"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestLogLevel(t *testing.T) {
+	defer slog.SetDefault(slog.Default())
+	defer SetLogLevel("")
+
+	buffy := new(bytes.Buffer)
+	LogTo(buffy)
+
+	if err := SetLogLevel(""); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	slog.Debug("dropped")
+	slog.Info("kept", TraceKey, "0123abcd")
+
+	if err := SetLogLevel("debug"); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	slog.Debug("debugging")
+
+	if err := SetLogLevel("loud"); err == nil {
+		t.Errorf("expected an error for a bad level")
+	}
+
+	got := buffy.String()
+	if strings.Contains(got, "dropped") {
+		t.Errorf("debug record logged at info level: %q", got)
+	}
+	for _, want := range []string{"msg=kept trace=0123abcd", "msg=debugging"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("log %q is missing %q", got, want)
+		}
+	}
+}
+
+func TestNewTraceID(t *testing.T) {
+	a, b := NewTraceID(), NewTraceID()
+	if !regexp.MustCompile("^[0-9a-f]{16}$").MatchString(a) {
+		t.Errorf("bad trace ID %q", a)
+	}
+	if a == b {
+		t.Errorf("trace IDs repeat: %q", a)
+	}
+}
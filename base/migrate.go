@@ -0,0 +1,98 @@
+package base
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// ConfigVersion is the version of the configuration written by this
+// leap. Older configurations are migrated when read:
+//
+//	0: the legacy single project Configuration. It has no version. Only
+//	   migrated by -updateconfig.
+//	1: the first GlobalConfiguration. Legacy configurations converted by
+//	   older leaps have #FIX# placeholders in remoteproject and
+//	   remotepath.
+//	2: remoteproject (never used) is gone and the placeholders are
+//	   cleared so that validation reports the missing remote paths.
+const ConfigVersion = 2
+
+// fixPlaceholder marks the values that version 1 conversions couldn't
+// provide.
+const fixPlaceholder = "#FIX#"
+
+// migrations[v] migrates a version v configuration to version v+1.
+var migrations = map[int]func(*GlobalConfiguration) error{
+	1: migrateV1,
+}
+
+func migrateV1(gc *GlobalConfiguration) error {
+	for _, p := range gc.Projects {
+		p.Remoteproject = ""
+		if p.Remotepath == fixPlaceholder {
+			p.Remotepath = ""
+		}
+	}
+	return nil
+}
+
+// migrate brings gc up to ConfigVersion.
+func migrate(gc *GlobalConfiguration) error {
+	for gc.Version < ConfigVersion {
+		m, ok := migrations[gc.Version]
+		if !ok {
+			return fmt.Errorf("can't migrate configuration version %d", gc.Version)
+		}
+		if err := m(gc); err != nil {
+			return fmt.Errorf("can't migrate configuration from version %d: %v", gc.Version, err)
+		}
+		gc.Version++
+	}
+	return nil
+}
+
+// decodeConfig decodes the contents of a configuration file. It returns
+// either a GlobalConfiguration migrated to ConfigVersion or (for version
+// 0) a legacy Configuration.
+func decodeConfig(b []byte) (*GlobalConfiguration, *Configuration, error) {
+	var probe struct {
+		Version *int `json:"version"`
+	}
+	if err := json.Unmarshal(b, &probe); err != nil {
+		return nil, nil, fmt.Errorf("configuration isn't valid JSON: %v", err)
+	}
+
+	if probe.Version == nil {
+		config := new(Configuration)
+		if err := json.Unmarshal(b, config); err != nil {
+			return nil, nil, fmt.Errorf("can't decode legacy configuration: %v", err)
+		}
+		return nil, config, nil
+	}
+
+	switch v := *probe.Version; {
+	case v < 1:
+		return nil, nil, fmt.Errorf("configuration version %d is invalid", v)
+	case v > ConfigVersion:
+		return nil, nil, fmt.Errorf("configuration version %d is newer than version %d supported by this leap", v, ConfigVersion)
+	}
+
+	gc := new(GlobalConfiguration)
+	if err := json.Unmarshal(b, gc); err != nil {
+		return nil, nil, fmt.Errorf("can't decode version %d configuration: %v", *probe.Version, err)
+	}
+	if err := migrate(gc); err != nil {
+		return nil, nil, err
+	}
+	return gc, nil, nil
+}
+
+// upgradeLegacy migrates a legacy (version 0) configuration to
+// ConfigVersion.
+func upgradeLegacy(config *Configuration) (*GlobalConfiguration, error) {
+	gc := updateConfig(config)
+	if err := migrate(gc); err != nil {
+		return nil, err
+	}
+	return gc, nil
+}
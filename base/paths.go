@@ -0,0 +1,108 @@
+package base
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// paths finds where leap keeps its files on an operating system with an
+// environment. macOS keeps the historical locations. Other Unix systems
+// follow the XDG base directory specification.
+//
+// The previews under SubPrefix aren't moved: the encoded paths under
+// Prefix are exchanged between the client, the server and Alfred so must
+// be the same everywhere.
+type paths struct {
+	goos   string
+	getenv func(string) string
+	stat   func(string) (os.FileInfo, error)
+}
+
+var platform = paths{
+	goos:   runtime.GOOS,
+	getenv: os.Getenv,
+	stat:   os.Stat,
+}
+
+func (p paths) home() string {
+	home := p.getenv("HOME")
+	if p.goos == "windows" && home == "" {
+		home = p.getenv("USERPROFILE")
+	}
+	return home
+}
+
+// xdg returns the directory named by the XDG environment variable name or
+// fallback under the home directory if it's unset or not absolute.
+func (p paths) xdg(name, fallback string) string {
+	if dir := p.getenv(name); filepath.IsAbs(dir) {
+		return dir
+	}
+	return filepath.Join(p.home(), fallback)
+}
+
+// configFile is the user's configuration file. A ~/.leaprc is used
+// on XDG systems until there's a configuration in XDG_CONFIG_HOME.
+func (p paths) configFile() string {
+	legacy := filepath.Clean(filepath.Join(p.home(), ".leaprc"))
+	switch p.goos {
+	case "darwin", "windows", "plan9":
+		return legacy
+	}
+	xdg := filepath.Join(p.xdg("XDG_CONFIG_HOME", ".config"), "leap", "leaprc")
+	if _, err := p.stat(xdg); err != nil {
+		if _, err := p.stat(legacy); err == nil {
+			return legacy
+		}
+	}
+	return xdg
+}
+
+func (p paths) cacheDir() string {
+	switch p.goos {
+	case "darwin":
+		return filepath.Join(p.home(), "Library", "Caches", "leap")
+	case "windows":
+		if dir := p.getenv("LocalAppData"); dir != "" {
+			return filepath.Join(dir, "leap")
+		}
+		return filepath.Join(p.home(), "AppData", "Local", "leap")
+	case "plan9":
+		return filepath.Join(p.home(), "lib", "cache", "leap")
+	}
+	return filepath.Join(p.xdg("XDG_CACHE_HOME", ".cache"), "leap")
+}
+
+// stateDir is only distinct from the cacheDir on XDG systems.
+func (p paths) stateDir() string {
+	switch p.goos {
+	case "darwin", "windows", "plan9":
+		return p.cacheDir()
+	}
+	return filepath.Join(p.xdg("XDG_STATE_HOME", filepath.Join(".local", "state")), "leap")
+}
+
+func (p paths) logDir(what string) string {
+	if p.goos == "darwin" {
+		return filepath.Join(p.home(), "Library", "Logs", what)
+	}
+	return filepath.Join(p.stateDir(), "logs", what)
+}
+
+// CacheDir returns the directory of leap's caches: files that can be
+// recreated.
+func CacheDir() string {
+	return platform.cacheDir()
+}
+
+// StateDir returns the directory of the state that leap keeps between
+// invocations such as query histories.
+func StateDir() string {
+	return platform.stateDir()
+}
+
+// LogDir returns the directory of the logs of what.
+func LogDir(what string) string {
+	return platform.logDir(what)
+}
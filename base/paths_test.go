@@ -0,0 +1,96 @@
+package base
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPaths(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		goos     string
+		env      map[string]string
+		existing []string
+		config   string
+		cache    string
+		state    string
+		logs     string
+	}{
+		{
+			name:   "darwin",
+			goos:   "darwin",
+			env:    map[string]string{"HOME": "/Users/g", "XDG_CONFIG_HOME": "/Users/g/.config"},
+			config: "/Users/g/.leaprc",
+			cache:  "/Users/g/Library/Caches/leap",
+			state:  "/Users/g/Library/Caches/leap",
+			logs:   "/Users/g/Library/Logs/leap",
+		},
+		{
+			name:   "linux defaults",
+			goos:   "linux",
+			env:    map[string]string{"HOME": "/home/g"},
+			config: "/home/g/.config/leap/leaprc",
+			cache:  "/home/g/.cache/leap",
+			state:  "/home/g/.local/state/leap",
+			logs:   "/home/g/.local/state/leap/logs/leap",
+		},
+		{
+			name: "linux xdg",
+			goos: "linux",
+			env: map[string]string{
+				"HOME":            "/home/g",
+				"XDG_CONFIG_HOME": "/cfg",
+				"XDG_CACHE_HOME":  "/cache",
+				"XDG_STATE_HOME":  "/state",
+			},
+			existing: []string{"/home/g/.leaprc", "/cfg/leap/leaprc"},
+			config:   "/cfg/leap/leaprc",
+			cache:    "/cache/leap",
+			state:    "/state/leap",
+			logs:     "/state/leap/logs/leap",
+		},
+		{
+			name:     "linux legacy config and relative xdg",
+			goos:     "linux",
+			env:      map[string]string{"HOME": "/home/g", "XDG_STATE_HOME": "state"},
+			existing: []string{"/home/g/.leaprc"},
+			config:   "/home/g/.leaprc",
+			cache:    "/home/g/.cache/leap",
+			state:    "/home/g/.local/state/leap",
+			logs:     "/home/g/.local/state/leap/logs/leap",
+		},
+		{
+			name:   "windows",
+			goos:   "windows",
+			env:    map[string]string{"USERPROFILE": "/Users/g", "LocalAppData": "/Users/g/AppData/Local"},
+			config: "/Users/g/.leaprc",
+			cache:  "/Users/g/AppData/Local/leap",
+			state:  "/Users/g/AppData/Local/leap",
+			logs:   "/Users/g/AppData/Local/leap/logs/leap",
+		},
+	} {
+		p := paths{
+			goos:   tc.goos,
+			getenv: func(k string) string { return tc.env[k] },
+			stat: func(fp string) (os.FileInfo, error) {
+				for _, e := range tc.existing {
+					if filepath.FromSlash(e) == fp {
+						return nil, nil
+					}
+				}
+				return nil, os.ErrNotExist
+			},
+		}
+		for _, c := range []struct{ what, got, want string }{
+			{"config", p.configFile(), tc.config},
+			{"cache", p.cacheDir(), tc.cache},
+			{"state", p.stateDir(), tc.state},
+			{"logs", p.logDir("leap"), tc.logs},
+		} {
+			if want := filepath.FromSlash(c.want); c.got != want {
+				t.Errorf("%s: %s got %q want %q", tc.name, c.what, c.got, want)
+			}
+		}
+	}
+}
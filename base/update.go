@@ -3,131 +3,200 @@ package base
 import (
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
-	"strings"
+	"sort"
 )
 
 var (
-	host      = flag.String("host", "", "Configure hostname for server. Empty host is short-circuited to operate in-memory.")
+	host      = flag.String("host", "", "Configure hostname for server. Empty host is short-circuited to operate in-memory. Prefer leap config set host.")
 	indexpath = flag.String("indexpath", "",
-		"Configure the path to the index file. Use CSEARCHINDEX if not provided. Client-only invocations ignore the configured index path.")
+		"Configure the path to the index file. Use CSEARCHINDEX if not provided. Client-only invocations ignore the configured index path. Prefer leap config set indexpath.")
 	resetpath = flag.Bool("resetpath", false,
-		"Clear the configured index path.")
+		"Clear the configured index path. Prefer leap config unset indexpath.")
 	remote = flag.Bool("remote", false,
-		"Update the configuration file to specify that leap should operate in remote mode.")
+		"Update the configuration file to specify that leap should operate in remote mode. Prefer leap config set remote true.")
 	local = flag.Bool("local", false,
-		"Update the configuration file to specify that leap should operate in local mode. Only one of -local and -remote can be specified.")
+		"Update the configuration file to specify that leap should operate in local mode. Only one of -local and -remote can be specified. Prefer leap config set remote false.")
 	setprefix = flag.Bool("setprefix", false,
-		"Set the path trimming prefixes to the given paths.")
+		"Set the path trimming prefixes to the given paths. Prefer leap prefix add and rm.")
 	update      = flag.Bool("updateconfig", false, "Upgrade the configuration version to the new format. Must be used by itself.")
-	setproject  = flag.String("proj", "", "Set the current project configuration or create a new one")
-	listproject = flag.Bool("lsproj", false, "List the projects")
+	setproject  = flag.String("proj", "", "Set the current project configuration or create a new one. Prefer leap project add and use.")
+	listproject = flag.Bool("lsproj", false, "List the projects. Prefer leap project ls.")
+	addbookmark = flag.String("bookmark", "",
+		"Bookmark the location given as the argument (path:line or path:/regexp/) with this name in the current project. Query it with 'name.")
+	rmbookmark  = flag.String("rmbookmark", "", "Remove the bookmark with this name from the current project.")
+	lsbookmarks = flag.Bool("lsbookmarks", false, "List the bookmarks of the current project.")
 )
 
-// updateNewStyleConfiguration updates ncc based on the args. We can't
-// get here without actually already having a new-style config. update
-// must be the only command and needs to be handled separately.
-func (ncc *GlobalConfiguration) updateNewStyleConfiguration(path string, args []string) {
-	// Exit if we are an unsupported command combination.
-	if *update || *remote && *local || *listproject && *setproject != "" || *resetpath && *indexpath != "" {
-		fmt.Println("Invalid command combination.")
-		flag.Usage()
-		os.Exit(1)
+// flagCommands returns the subcommands equivalent to the configuration
+// flags given the configuration gc and the remaining arguments args.
+func flagCommands(gc *GlobalConfiguration, args []string) ([][]string, error) {
+	if *remote && *local || *listproject && *setproject != "" || *resetpath && *indexpath != "" {
+		return nil, &UsageError{"invalid combination of flags"}
 	}
-
 	if *listproject {
-		// TODO(rjk): Dump the necessary content to give me autoocomplete list
-		// The goal is to make this auto-complete  capable in Alfred
-		s := make([]string, len(ncc.Projects))
-		for k := range ncc.Projects {
-			s = append(s, k)
-		}
-		fmt.Println(strings.Join(s, ", "))
-		os.Exit(1)
+		return [][]string{{"project", "ls"}}, nil
 	}
 
+	cmds := make([][]string, 0)
 	if *setproject != "" {
-		if _, ok := ncc.Projects[*setproject]; !ok {
-			ncc.Projects[*setproject] = &Project{
-				Host:          "",
-				Indexpath:     "",
-				Remote:        false,
-				Prefixes:      []string{},
-				Remoteproject: "",
-				Remotepath:    "",
-			}
+		if _, ok := gc.Projects[*setproject]; !ok {
+			cmds = append(cmds, []string{"project", "add", *setproject})
 		}
-		ncc.Currentproject = *setproject
+		cmds = append(cmds, []string{"project", "use", *setproject})
 	}
-	cp := ncc.Projects[ncc.Currentproject]
-
 	switch {
 	case *remote:
-		cp.Remote = true
+		cmds = append(cmds, []string{"config", "set", "remote", "true"})
 	case *local:
-		cp.Remote = false
+		cmds = append(cmds, []string{"config", "set", "remote", "false"})
 	}
-
 	switch {
 	case *resetpath:
-		cp.Indexpath = ""
+		cmds = append(cmds, []string{"config", "unset", "indexpath"})
 	case *indexpath != "":
-		cp.Indexpath = *indexpath
+		cmds = append(cmds, []string{"config", "set", "indexpath", *indexpath})
 	}
-
 	if *host != "" {
-		cp.Indexpath = *indexpath
+		cmds = append(cmds, []string{"config", "set", "host", *host})
 	}
-
 	if *setprefix {
-		cp.Prefixes = args
+		cmds = append(cmds, []string{"config", "unset", "prefixes"})
+		if len(args) > 0 {
+			cmds = append(cmds, append([]string{"prefix", "add"}, args...))
+		}
 	}
+	return cmds, nil
+}
 
-	if err := saveNewConfig(ncc, path); err != nil {
-		log.Fatalf("Failed to write configuration: %v", err)
+// updateFromFlags updates ncc based on the flags and args, writing any
+// listings to out. It reports if ncc needs to be saved. -updateconfig
+// saves ncc at the current version and ignores the other flags.
+func (ncc *GlobalConfiguration) updateFromFlags(args []string, out io.Writer) (bool, error) {
+	if *update {
+		// The configuration was migrated to the current version when read.
+		return true, nil
 	}
-	os.Exit(0)
-}
 
-// UpdateConfigIfNecessary adjusts the saved configuration based on
-// command line flags. May exit the program.
-// TODO(rjk): This is not well structured. This code could be better.
-func UpdateConfigIfNecessary(args []string, testingconfig bool) {
-	if !(*remote || *local || *host != "" || *indexpath != "" || *resetpath || *setprefix || *update || *listproject || *setproject != "") {
-		return
+	cmds, err := flagCommands(ncc, args)
+	if err != nil {
+		return false, err
+	}
+	env := &commandEnv{gc: ncc, out: out}
+	changed := false
+	for _, c := range cmds {
+		ch, err := runCommand(env, c)
+		if err != nil {
+			return false, err
+		}
+		changed = changed || ch
 	}
 
-	fp := Filepath(testingconfig)
-	fd, err := os.Open(fp)
+	if !(*lsbookmarks || *addbookmark != "" || *rmbookmark != "") {
+		return changed, nil
+	}
+	_, cp, err := env.target()
 	if err != nil {
-		fmt.Printf("Failed to open configuration %s because %v\n", fp, err)
+		return false, err
 	}
 
-	newconfig, err := getNewConfig(fd)
+	if *lsbookmarks {
+		names := make([]string, 0, len(cp.Bookmarks))
+		for n := range cp.Bookmarks {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		for _, n := range names {
+			fmt.Fprintf(out, "%s\t%s\n", n, cp.Bookmarks[n])
+		}
+		return changed, nil
+	}
+
+	if *addbookmark != "" {
+		if len(args) != 1 {
+			return false, &UsageError{"-bookmark needs one location: path:line or path:/regexp/"}
+		}
+		bm, err := ParseBookmark(args[0])
+		if err != nil {
+			return false, err
+		}
+		if cp.Bookmarks == nil {
+			cp.Bookmarks = make(map[string]string)
+		}
+		cp.Bookmarks[*addbookmark] = bm.String()
+	}
+
+	if *rmbookmark != "" {
+		if _, ok := cp.Bookmarks[*rmbookmark]; !ok {
+			return false, fmt.Errorf("no bookmark %s in project %s", *rmbookmark, ncc.Currentproject)
+		}
+		delete(cp.Bookmarks, *rmbookmark)
+	}
+	return true, nil
+}
+
+// UpdateConfigIfNecessary adjusts the saved configuration based on
+// command line flags, writing any listings to out. It reports if any of
+// the flags were given: leap should then exit with the ExitCode of the
+// error. The leap config, project and prefix subcommands replace these
+// flags.
+func UpdateConfigIfNecessary(args []string, testingconfig bool, out io.Writer) (bool, error) {
+	if !(*remote || *local || *host != "" || *indexpath != "" || *resetpath || *setprefix || *update || *listproject || *setproject != "" ||
+		*addbookmark != "" || *rmbookmark != "" || *lsbookmarks) {
+		return false, nil
+	}
+	return true, updateFromFlagsFile(Filepath(testingconfig), args, out)
+}
+
+// updateFromFlagsFile is UpdateConfigIfNecessary for the configuration
+// file fp.
+func updateFromFlagsFile(fp string, args []string, out io.Writer) error {
+	// Held until done so that the configuration can't change between
+	// reading and writing it.
+	unlock, err := lockConfig(fp)
 	if err != nil {
-		fmt.Printf("Can't treat %s as new configuration because %v\n", fp, err)
+		return fmt.Errorf("failed to lock configuration: %v", err)
+	}
+	defer unlock()
+
+	var newconfig *GlobalConfiguration
+	if fd, err := os.Open(fp); err == nil {
+		// A legacy configuration isn't a new configuration.
+		newconfig, _ = getNewConfig(fd)
+		fd.Close()
 	}
 
 	if newconfig != nil {
-		// We have a new configuration.
-		newconfig.updateNewStyleConfiguration(fp, args)
-		return
+		changed, err := newconfig.updateFromFlags(args, out)
+		if err == nil && changed {
+			err = saveNewConfig(newconfig, fp)
+		}
+		return err
 	}
 
 	config, err := GetConfiguration(fp)
+	if err != nil {
+		return fmt.Errorf("can't read configuration %s: %v", fp, err)
+	}
+	if *addbookmark != "" || *rmbookmark != "" || *lsbookmarks {
+		return fmt.Errorf("bookmarks require an upgraded configuration: run leap -updateconfig")
+	}
 	if *update {
-		newconfig := updateConfig(config)
+		newconfig, err := upgradeLegacy(config)
+		if err != nil {
+			return fmt.Errorf("can't update config %s because %v", fp, err)
+		}
 		if err := saveNewConfig(newconfig, fp); err != nil {
-			log.Printf("can't update config %s because %v", fp, err)
+			return fmt.Errorf("can't update config %s because %v", fp, err)
 		}
-		os.Exit(1)
+		return nil
 	}
 
 	switch {
 	case *remote && *local:
-		flag.Usage()
-		os.Exit(1)
+		return &UsageError{"only one of -local and -remote can be given"}
 	case *remote:
 		config.Connect = true
 	case *local:
@@ -136,8 +205,7 @@ func UpdateConfigIfNecessary(args []string, testingconfig bool) {
 
 	switch {
 	case *resetpath && *indexpath != "":
-		flag.Usage()
-		os.Exit(1)
+		return &UsageError{"only one of -resetpath and -indexpath can be given"}
 	case *resetpath:
 		config.Indexpath = ""
 	case *indexpath != "":
@@ -153,8 +221,8 @@ func UpdateConfigIfNecessary(args []string, testingconfig bool) {
 		config.Prefixes = args
 	}
 
-	if err := SaveConfiguration(config, fp); err != nil {
-		log.Fatalf("Failed to write configuration: %v", err)
+	if err := saveConfiguration(config, fp); err != nil {
+		return fmt.Errorf("failed to write configuration: %v", err)
 	}
-	os.Exit(0)
+	return nil
 }
@@ -0,0 +1,140 @@
+package base
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ConfigError is a problem with a configuration.
+type ConfigError struct {
+	// Project is the project with the problem or "" if the problem is
+	// with the whole configuration.
+	Project string
+	Field   string
+	Problem string
+}
+
+func (e *ConfigError) Error() string {
+	if e.Project == "" {
+		return fmt.Sprintf("%s: %s", e.Field, e.Problem)
+	}
+	return fmt.Sprintf("project %s: %s: %s", e.Project, e.Field, e.Problem)
+}
+
+// Validate returns the problems with gc, ordered by project.
+func (gc *GlobalConfiguration) Validate() []error {
+	errs := make([]error, 0)
+	if gc.Version != ConfigVersion {
+		errs = append(errs, &ConfigError{Field: "version", Problem: fmt.Sprintf("is %d not %d", gc.Version, ConfigVersion)})
+	}
+	if len(gc.Projects) == 0 {
+		errs = append(errs, &ConfigError{Field: "projects", Problem: "there are none"})
+	}
+	if _, ok := gc.Projects[gc.Currentproject]; !ok {
+		errs = append(errs, &ConfigError{Field: "currentproject", Problem: fmt.Sprintf("unknown project %q", gc.Currentproject)})
+	}
+	for _, name := range gc.ProjectNames() {
+		errs = append(errs, gc.Projects[name].validate(name)...)
+	}
+	return errs
+}
+
+// validate returns the problems with the project name.
+func (p *Project) validate(name string) []error {
+	errs := make([]error, 0)
+	bad := func(field, format string, args ...interface{}) {
+		errs = append(errs, &ConfigError{Project: name, Field: field, Problem: fmt.Sprintf(format, args...)})
+	}
+
+	if p.Remote && p.Host == "" {
+		bad("host", "remote project has no host")
+	}
+	for i, ix := range p.AllIndexes() {
+		field := "indexes"
+		if i == 0 {
+			field = "indexpath"
+		}
+		if ix.Indexpath == fixPlaceholder || ix.Remotepath == fixPlaceholder {
+			bad(field, "has a %s placeholder", fixPlaceholder)
+		}
+		if p.Remote && ix.Remotepath == "" {
+			bad(field, "remote project index %q has no remote path", ix.Indexpath)
+		}
+		for _, e := range validatePrefixes(ix.Prefixes) {
+			bad("prefixes", "%s", e)
+		}
+	}
+
+	for _, r := range p.Rewrites {
+		if !filepath.IsAbs(r.From) || !filepath.IsAbs(r.To) {
+			bad("rewrites", "rewrite from %q to %q isn't between absolute paths", r.From, r.To)
+		}
+	}
+	if p.Mount != "" && !filepath.IsAbs(p.Mount) {
+		bad("mount", "%q is not absolute", p.Mount)
+	}
+	if p.Loglevel != "" {
+		var l slog.Level
+		if err := l.UnmarshalText([]byte(p.Loglevel)); err != nil {
+			bad("loglevel", "%q is not debug, info, warn or error", p.Loglevel)
+		}
+	}
+
+	marks := make([]string, 0, len(p.Bookmarks))
+	for n := range p.Bookmarks {
+		marks = append(marks, n)
+	}
+	sort.Strings(marks)
+	for _, n := range marks {
+		if _, err := ParseBookmark(p.Bookmarks[n]); err != nil {
+			bad("bookmarks", "%s: %v", n, err)
+		}
+	}
+	return errs
+}
+
+// validatePrefixes returns the problems with the trimming prefixes of an
+// index. A prefix inside of another can't be trimmed.
+func validatePrefixes(prefixes []string) []string {
+	problems := make([]string, 0)
+	for i, p := range prefixes {
+		switch {
+		case p == "":
+			problems = append(problems, "prefix is empty")
+			continue
+		case !filepath.IsAbs(p):
+			problems = append(problems, fmt.Sprintf("prefix %q is not absolute", p))
+		}
+		for j, q := range prefixes {
+			if i != j && p != q && strings.HasPrefix(p, strings.TrimSuffix(q, "/")+"/") {
+				problems = append(problems, fmt.Sprintf("prefix %q is inside prefix %q", p, q))
+			}
+		}
+	}
+	return problems
+}
+
+// CheckConfiguration reports the problems with the configuration file at
+// fp without changing it. A legacy configuration is checked as it would
+// be after -updateconfig.
+func CheckConfiguration(fp string) ([]error, error) {
+	b, err := os.ReadFile(fp)
+	if err != nil {
+		return nil, fmt.Errorf("can't read config file %s because %v", fp, err)
+	}
+	gc, config, err := decodeConfig(b)
+	if err != nil {
+		return nil, fmt.Errorf("bad config file %s: %v", fp, err)
+	}
+	if config != nil {
+		if gc, err = upgradeLegacy(config); err != nil {
+			return nil, err
+		}
+	}
+	useProject(gc)
+	return gc.Validate(), nil
+}
@@ -39,10 +39,10 @@ func Shutdown(config *base.Configuration) error {
 	return shutdownimpl(client)
 }
 
+// ReIndexAndTransfer re-indexes each of the current project's indexes on
+// the remote and transfers them to the local machine.
 func ReIndexAndTransfer(config *base.GlobalConfiguration) error {
 	localproject := config.Currentproject
-	localpath := config.Projects[localproject].Indexpath
-	remotepath := config.Projects[localproject].Remotepath
 	serverAddress := config.Projects[localproject].Host
 
 	// this client thinger is what I want in the implementatino of the
@@ -55,7 +55,12 @@ func ReIndexAndTransfer(config *base.GlobalConfiguration) error {
 		return err
 	}
 
-	return reIndexAndTransferImpl(leapserver, localpath, remotepath)
+	for _, ix := range config.Projects[localproject].AllIndexes() {
+		if err := reIndexAndTransferImpl(leapserver, ix.Indexpath, ix.Remotepath); err != nil {
+			return fmt.Errorf("can't update %s: %v", ix.Indexpath, err)
+		}
+	}
+	return nil
 }
 
 // ReIndexAndTransfer uses cindex to index a remote server's code. Then it
@@ -0,0 +1,179 @@
+package client
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/rjkroege/leap/base"
+	"github.com/rjkroege/leap/output"
+	"github.com/rjkroege/leap/preview"
+	"github.com/rjkroege/leap/server"
+)
+
+// MaxPreviewBytes caps how much file content is transferred from the
+// server to make the previews for a single query.
+const MaxPreviewBytes = 8 * MB
+
+// MaxCachedFileBytes bounds the total size of the copies kept by
+// FileCache.
+const MaxCachedFileBytes = 256 * MB
+
+// FileCacheDir is where FileCache keeps its copies.
+func FileCacheDir() string {
+	return filepath.Join(base.CacheDir(), "files")
+}
+
+// FileCacheSweeper returns a preview.Cache whose Sweep bounds the copies
+// kept by FileCache to MaxCachedFileBytes. The copies have the
+// modification time of the server's file so those changed least recently
+// on the server are evicted first. That's good enough: an evicted copy is
+// just fetched again.
+func FileCacheSweeper() *preview.Cache {
+	return preview.New(FileCacheDir(), MaxCachedFileBytes)
+}
+
+// caller lets me mock out the rpc.Client.
+type caller interface {
+	Call(serviceMethod string, args interface{}, reply interface{}) error
+}
+
+// FileCache keeps local copies of files on a project's server so that
+// previews of remote results can be made on the client. Each copy is
+// keyed by the server and path of the file and has the file's
+// modification time on the server.
+type FileCache struct {
+	dir     string
+	host    string
+	indexes []base.Index
+	limit   int64
+
+	leapserver caller
+	previews   *preview.Cache
+	trace      string
+}
+
+// NewFileCache makes a FileCache for the project described by config
+// that fetches files over the connection of ris.
+func NewFileCache(config *base.Configuration, ris *RemoteInternalSearcher) (*FileCache, error) {
+	dir := FileCacheDir()
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("can't make cache directory %s: %v", dir, err)
+	}
+
+	return &FileCache{
+		dir:        dir,
+		host:       config.Hostname,
+		indexes:    config.AllIndexes(),
+		limit:      MaxPreviewBytes,
+		leapserver: ris.leapserver,
+		trace:      ris.trace,
+		previews:   preview.Default(),
+	}, nil
+}
+
+// cachepath returns where the copy of the server's file at path is kept.
+func (fc *FileCache) cachepath(path string) string {
+	sum := sha256.Sum256([]byte(fc.host + "\x00" + path))
+	return filepath.Join(fc.dir, hex.EncodeToString(sum[:]))
+}
+
+// Fetch makes sure that the cache has current copies of the server's
+// files at paths. It returns the local copy for each path that it could
+// provide. Files that don't fit in the cache's limit are left out.
+func (fc *FileCache) Fetch(paths []string) (map[string]string, error) {
+	args := server.FetchFilesArgs{
+		Files:   make([]server.FileRequest, 0, len(paths)),
+		Indexes: fc.indexes,
+		Limit:   fc.limit,
+		Trace:   fc.trace,
+	}
+	for _, p := range paths {
+		req := server.FileRequest{Path: p}
+		if fi, err := os.Stat(fc.cachepath(p)); err == nil {
+			req.ModTime = fi.ModTime()
+		}
+		args.Files = append(args.Files, req)
+	}
+
+	var reply server.FetchFilesResult
+	if err := fc.leapserver.Call("Server.FetchFiles", args, &reply); err != nil {
+		return nil, fmt.Errorf("can't invoke FetchFiles on server: %v", err)
+	}
+
+	copies := make(map[string]string, len(reply.Files))
+	for _, f := range reply.Files {
+		cp := fc.cachepath(f.Path)
+		switch {
+		case f.Err != "":
+			log.Printf("can't fetch %s: %s", f.Path, f.Err)
+		case f.Skipped:
+			log.Printf("not fetching %s: it doesn't fit in the %d byte limit", f.Path, fc.limit)
+		case f.NotModified:
+			copies[f.Path] = cp
+		default:
+			if err := writeCacheFile(cp, f.Contents, f.ModTime); err != nil {
+				log.Printf("can't cache %s: %v", f.Path, err)
+				continue
+			}
+			copies[f.Path] = cp
+		}
+	}
+	return copies, nil
+}
+
+// writeCacheFile replaces the file at path with contents and gives it
+// the modification time mtime.
+func writeCacheFile(path string, contents []byte, mtime time.Time) error {
+	tmp := path + "-temporary"
+	if err := os.WriteFile(tmp, contents, 0600); err != nil {
+		return err
+	}
+	if err := os.Chtimes(tmp, mtime, mtime); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Materialize puts local copies of the server's files at the encoded
+// paths under base.Prefix named by the Arg of the content search results
+// in entries. The Args name files on the server. The copies are put where
+// rules will rewrite the Args to point.
+func (fc *FileCache) Materialize(entries []output.Entry, rules []base.Rewrite) error {
+	paths := make([]string, 0, len(entries))
+	seen := make(map[string]bool)
+	for _, e := range entries {
+		head, path := splitEncoded(e.Arg)
+		if head == "" || seen[path] {
+			continue
+		}
+		seen[path] = true
+		paths = append(paths, path)
+	}
+	if len(paths) == 0 {
+		return nil
+	}
+
+	copies, err := fc.Fetch(paths)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		head, path := splitEncoded(e.Arg)
+		cp, ok := copies[path]
+		if head == "" || !ok {
+			continue
+		}
+		dest := rewriteArg(rules, e.Arg)
+		if err := fc.previews.Put(cp, dest); err != nil {
+			log.Println(cp, dest, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package client
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rjkroege/leap/base"
+	"github.com/rjkroege/leap/output"
+	"github.com/rjkroege/leap/preview"
+	"github.com/rjkroege/leap/server"
+)
+
+// fakeFetcher serves FetchFiles from the local filesystem and records
+// what was sent.
+type fakeFetcher struct {
+	sent   []string
+	traces []string
+}
+
+func (ff *fakeFetcher) Call(method string, args interface{}, reply interface{}) error {
+	if method != "Server.FetchFiles" {
+		return fmt.Errorf("unexpected method %s", method)
+	}
+	resp := reply.(*server.FetchFilesResult)
+	ff.traces = append(ff.traces, args.(server.FetchFilesArgs).Trace)
+	for _, req := range args.(server.FetchFilesArgs).Files {
+		f := server.FetchedFile{Path: req.Path}
+		fi, err := os.Stat(req.Path)
+		if err != nil {
+			f.Err = err.Error()
+		} else if f.ModTime = fi.ModTime(); f.ModTime.Equal(req.ModTime) {
+			f.NotModified = true
+		} else {
+			f.Contents, _ = os.ReadFile(req.Path)
+			ff.sent = append(ff.sent, req.Path)
+		}
+		resp.Files = append(resp.Files, f)
+	}
+	return nil
+}
+
+func TestFileCacheMaterialize(t *testing.T) {
+	remote := t.TempDir()
+	name := filepath.Join(remote, "src", "a.go")
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(name, []byte("package a\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	fetcher := new(fakeFetcher)
+	fc := &FileCache{
+		dir:        t.TempDir(),
+		host:       "remotehost",
+		limit:      MaxPreviewBytes,
+		leapserver: fetcher,
+		previews:   preview.New(t.TempDir(), preview.DefaultLimit),
+		trace:      "0123abcd",
+	}
+
+	entries := []output.Entry{
+		{Arg: fmt.Sprintf("/%s:1%s", base.Prefix, name)},
+		{Arg: fmt.Sprintf("/%s:3%s", base.Prefix, name)},
+		// Filename results have no preview.
+		{Arg: name},
+	}
+	rules := []base.Rewrite{{From: remote, To: "/n/remote"}}
+	for _, e := range entries[:2] {
+		defer os.Remove(rewriteArg(rules, e.Arg))
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := fc.Materialize(entries, rules); err != nil {
+			t.Fatalf("Materialize failed: %v", err)
+		}
+		for _, e := range entries[:2] {
+			dest := rewriteArg(rules, e.Arg)
+			contents, err := os.ReadFile(dest)
+			if err != nil {
+				t.Errorf("no preview at %s: %v", dest, err)
+				continue
+			}
+			if got, want := string(contents), "package a\n"; got != want {
+				t.Errorf("preview %s got %q want %q", dest, got, want)
+			}
+		}
+	}
+
+	// The file is only sent once.
+	if got, want := len(fetcher.sent), 1; got != want {
+		t.Errorf("sent %v, want %d file", fetcher.sent, want)
+	}
+	for _, tr := range fetcher.traces {
+		if tr != "0123abcd" {
+			t.Errorf("request had trace %q want 0123abcd", tr)
+		}
+	}
+}
+
+func TestFileCacheSweep(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	for i, name := range []string{"old", "newer", "newest"} {
+		mtime := now.Add(time.Duration(i-3) * time.Hour)
+		if err := writeCacheFile(filepath.Join(dir, name), []byte("0123456789"), mtime); err != nil {
+			t.Fatalf("can't write %s: %v", name, err)
+		}
+	}
+
+	// The copies are swept as FileCacheSweeper's are.
+	if err := preview.New(dir, 20).Sweep(); err != nil {
+		t.Fatalf("Sweep failed: %v", err)
+	}
+	for name, kept := range map[string]bool{"old": false, "newer": true, "newest": true} {
+		if _, err := os.Stat(filepath.Join(dir, name)); (err == nil) != kept {
+			t.Errorf("%s kept got %v want %v", name, err == nil, kept)
+		}
+	}
+}
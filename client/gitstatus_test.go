@@ -0,0 +1,131 @@
+package client
+
+import (
+	"log/slog"
+	"net"
+	"net/rpc"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rjkroege/leap/base"
+	"github.com/rjkroege/leap/git"
+	"github.com/rjkroege/leap/index"
+	"github.com/rjkroege/leap/search"
+	"github.com/rjkroege/leap/server"
+)
+
+// fakeGitServer reports that c.go in each root has been modified and
+// b.go was recently committed.
+type fakeGitServer struct {
+	roots []string
+}
+
+func (f *fakeGitServer) GitStatus(args server.GitStatusArgs, resp *server.GitStatusResult) error {
+	f.roots = args.Roots
+	resp.Files = make(map[string]int)
+	for _, r := range args.Roots {
+		resp.Files[filepath.Join(r, "c.go")] = git.Modified
+		resp.Files[filepath.Join(r, "b.go")] = git.Recent
+	}
+	return nil
+}
+
+// An older server without GitStatus.
+type fakeOldServer struct{}
+
+func (_ *fakeOldServer) Ping(arg string, result *string) error {
+	return nil
+}
+
+// dialFake connects a RemoteInternalSearcher to rcvr serving as Server.
+func dialFake(t *testing.T, rcvr interface{}) *RemoteInternalSearcher {
+	rs := rpc.NewServer()
+	if err := rs.RegisterName("Server", rcvr); err != nil {
+		t.Fatal(err)
+	}
+	cl, sv := net.Pipe()
+	go rs.ServeConn(sv)
+	leapserver := rpc.NewClient(cl)
+	t.Cleanup(func() { leapserver.Close() })
+	return &RemoteInternalSearcher{leapserver: leapserver}
+}
+
+func TestGitStatus(t *testing.T) {
+	fake := &fakeGitServer{}
+	ris := dialFake(t, fake)
+
+	st, err := ris.GitStatus([]string{"/proj"})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(fake.roots) != 1 || fake.roots[0] != "/proj" {
+		t.Errorf("server got roots %v", fake.roots)
+	}
+	if !st.Changed("/proj/c.go") || st.Changed("/proj/b.go") || st.Rank("/proj/b.go") != git.Recent {
+		t.Errorf("unexpected status for c.go %d and b.go %d", st.Rank("/proj/c.go"), st.Rank("/proj/b.go"))
+	}
+
+	if _, err := dialFake(t, &fakeOldServer{}).GitStatus([]string{"/proj"}); err == nil {
+		t.Errorf("expected an error from a server without GitStatus")
+	}
+}
+
+func TestUseGit(t *testing.T) {
+	tree := filepath.Join(t.TempDir(), "proj")
+	for _, name := range []string{"a.go", "b.go", "c.go"} {
+		if err := os.MkdirAll(tree, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(tree, name), []byte("package proj\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	indexpath := filepath.Join(t.TempDir(), "index")
+	if _, err := (index.Idx{}).ReIndex(indexpath, tree); err != nil {
+		t.Fatalf("can't index %s: %v", tree, err)
+	}
+	query := func(ris *RemoteInternalSearcher, changedonly bool) ([]string, error) {
+		multi := search.NewMultiSearch([]base.Index{{Indexpath: indexpath, Prefixes: []string{tree}}})
+		if err := ris.UseGit(multi, changedonly, slog.Default()); err != nil {
+			return nil, err
+		}
+		entries, err := multi.Query([]string{"go"}, ":", []string{""}, nil)
+		titles := make([]string, 0, len(entries))
+		for _, e := range entries {
+			titles = append(titles, e.Title)
+		}
+		return titles, err
+	}
+
+	// Only the changed files with !.
+	fake := &fakeGitServer{}
+	got, err := query(dialFake(t, fake), true)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(got) != 1 || got[0] != "c.go" {
+		t.Errorf("changed only got %v want [c.go]", got)
+	}
+	if len(fake.roots) != 1 || fake.roots[0] != tree {
+		t.Errorf("server got roots %v want [%s]", fake.roots, tree)
+	}
+
+	// Ranked otherwise.
+	got, err = query(dialFake(t, fake), false)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(got) != 3 || got[0] != "c.go" || got[1] != "b.go" {
+		t.Errorf("ranked got %v want c.go and b.go first", got)
+	}
+
+	// A server that can't read git fails ! but not ranking.
+	old := dialFake(t, &fakeOldServer{})
+	if _, err := query(old, true); err == nil {
+		t.Errorf("expected an error for changed only results without git status")
+	}
+	if got, err := query(old, false); err != nil || len(got) != 3 {
+		t.Errorf("unranked got %v, %v want 3 results", got, err)
+	}
+}
@@ -0,0 +1,51 @@
+package client
+
+import (
+	"fmt"
+	"net/rpc"
+	"os/exec"
+
+	"github.com/rjkroege/leap/base"
+	"github.com/rjkroege/leap/server"
+)
+
+// Mounter lets me mock out mounting a 9P file server.
+type Mounter interface {
+	Mount(addr, mountpoint string) error
+}
+
+// NinePFuse mounts with plan9port's 9pfuse. It has to be in the path.
+type NinePFuse struct{}
+
+func (_ NinePFuse) Mount(addr, mountpoint string) error {
+	if out, err := exec.Command("9pfuse", addr, mountpoint).CombinedOutput(); err != nil {
+		return fmt.Errorf("can't run 9pfuse %s %s because: %v: %s", addr, mountpoint, err, out)
+	}
+	return nil
+}
+
+// Mount asks the server of the project described by config to export
+// the project's trees and mounts them at the project's Mount.
+func Mount(config *base.Configuration, mounter Mounter) error {
+	if config.Mount == "" {
+		return fmt.Errorf("project %s has no mount point", config.Project())
+	}
+	leapserver, err := rpc.DialHTTP("tcp", config.Hostname+":1234")
+	if err != nil {
+		return fmt.Errorf("can't connect to %s:1234: %v", config.Hostname, err)
+	}
+	defer leapserver.Close()
+
+	return mountImpl(leapserver, config, mounter)
+}
+
+func mountImpl(leapserver caller, config *base.Configuration, mounter Mounter) error {
+	args := server.ExportArgs{
+		Indexes: config.AllIndexes(),
+	}
+	var reply server.ExportResult
+	if err := leapserver.Call("Server.Export", args, &reply); err != nil {
+		return fmt.Errorf("can't get server to export files: %v", err)
+	}
+	return mounter.Mount(fmt.Sprintf("tcp!%s!%d", config.Hostname, reply.Port), config.Mount)
+}
@@ -0,0 +1,59 @@
+package client
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/rjkroege/leap/base"
+	"github.com/rjkroege/leap/server"
+)
+
+type fakeExporter struct {
+	args server.ExportArgs
+}
+
+func (f *fakeExporter) Call(serviceMethod string, args interface{}, reply interface{}) error {
+	if serviceMethod != "Server.Export" {
+		return fmt.Errorf("unexpected method %s", serviceMethod)
+	}
+	f.args = args.(server.ExportArgs)
+	reply.(*server.ExportResult).Port = 5640
+	return nil
+}
+
+type fakeMounter struct {
+	addr, mountpoint string
+}
+
+func (f *fakeMounter) Mount(addr, mountpoint string) error {
+	f.addr, f.mountpoint = addr, mountpoint
+	return nil
+}
+
+func TestMount(t *testing.T) {
+	config := &base.Configuration{
+		Hostname:  "buildhost",
+		Indexpath: "/home/build/.csearchindex",
+		Mount:     "/n/build",
+	}
+	exporter := &fakeExporter{}
+	mounter := &fakeMounter{}
+
+	if err := mountImpl(exporter, config, mounter); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got, want := mounter.addr, "tcp!buildhost!5640"; got != want {
+		t.Errorf("mounted %q want %q", got, want)
+	}
+	if got, want := mounter.mountpoint, "/n/build"; got != want {
+		t.Errorf("mounted on %q want %q", got, want)
+	}
+	if got := len(exporter.args.Indexes); got != 1 {
+		t.Errorf("exported %d indexes want 1", got)
+	}
+
+	config.Mount = ""
+	if err := Mount(config, mounter); err == nil {
+		t.Errorf("expected an error for a project without a mount point")
+	}
+}
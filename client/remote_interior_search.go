@@ -2,11 +2,15 @@ package client
 
 import (
 	"fmt"
+	"log/slog"
 	"net/rpc"
+	"strings"
 
 	"github.com/google/codesearch/regexp"
 	"github.com/rjkroege/leap/base"
+	"github.com/rjkroege/leap/git"
 	"github.com/rjkroege/leap/output"
+	"github.com/rjkroege/leap/search"
 	"github.com/rjkroege/leap/server"
 )
 
@@ -14,6 +18,7 @@ type RemoteInternalSearcher struct {
 	prefixes    []string
 	remoteindex string
 	leapserver  *rpc.Client
+	trace       string
 }
 
 func (ris *RemoteInternalSearcher) ContentSearchResult(fnames []uint32, re *regexp.Regexp, suffix string) ([]output.Entry, error) {
@@ -22,6 +27,7 @@ func (ris *RemoteInternalSearcher) ContentSearchResult(fnames []uint32, re *rege
 		Suffix:      suffix,
 		Prefixes:    ris.prefixes,
 		Remoteindex: ris.remoteindex,
+		Trace:       ris.trace,
 	}
 	var reply server.ContentSearchResult
 
@@ -31,10 +37,10 @@ func (ris *RemoteInternalSearcher) ContentSearchResult(fnames []uint32, re *rege
 	return reply.Entries, nil
 }
 
+// NewRemoteInternalSearcher connects to the server of the project
+// described by config.
 func NewRemoteInternalSearcher(config *base.Configuration) (*RemoteInternalSearcher, error) {
-	newconfig := config.GetNewConfiguration()
-	localproject := newconfig.Currentproject
-	serverAddress := newconfig.Projects[localproject].Host
+	serverAddress := config.Hostname
 
 	leapserver, err := rpc.DialHTTP("tcp", serverAddress+":1234")
 	if err != nil {
@@ -42,8 +48,96 @@ func NewRemoteInternalSearcher(config *base.Configuration) (*RemoteInternalSearc
 	}
 
 	return &RemoteInternalSearcher{
-		prefixes:    newconfig.Projects[localproject].Prefixes,
-		remoteindex: newconfig.Projects[localproject].Remotepath,
+		prefixes:    config.Prefixes,
+		remoteindex: config.AllIndexes()[0].Remotepath,
 		leapserver:  leapserver,
 	}, nil
 }
+
+// ForIndex returns a RemoteInternalSearcher sharing the connection of ris
+// that searches inside of the files of the server's copy of ix.
+func (ris *RemoteInternalSearcher) ForIndex(ix base.Index) *RemoteInternalSearcher {
+	return &RemoteInternalSearcher{
+		prefixes:    ix.Prefixes,
+		remoteindex: ix.Remotepath,
+		leapserver:  ris.leapserver,
+		trace:       ris.trace,
+	}
+}
+
+// GitStatus asks the server for the git activity in the working trees of
+// roots, the server's paths of the indexed trees.
+func (ris *RemoteInternalSearcher) GitStatus(roots []string) (*git.Status, error) {
+	args := server.GitStatusArgs{
+		Roots: roots,
+		Trace: ris.trace,
+	}
+	var reply server.GitStatusResult
+	if err := ris.leapserver.Call("Server.GitStatus", args, &reply); err != nil {
+		return nil, fmt.Errorf("can't invoke GitStatus on server: %v", err)
+	}
+	st := git.NewStatus()
+	for name, rank := range reply.Files {
+		st.Add(name, rank)
+	}
+	return st, nil
+}
+
+// UseGit makes multi rank files by the git activity on the server as
+// search.MultiSearch.UseGit does. It's an error if changedonly results
+// were asked for and the server can't say which files changed. Otherwise
+// failures are only logged to logger.
+func (ris *RemoteInternalSearcher) UseGit(multi *search.MultiSearch, changedonly bool, logger *slog.Logger) error {
+	// The local index is a copy of the server's so its paths are the
+	// server's.
+	st, err := ris.GitStatus(multi.Paths())
+	if err != nil && changedonly {
+		return fmt.Errorf("can't limit the results to changed files: %v", err)
+	} else if err != nil {
+		logger.Warn("not ranking by git activity", "err", err)
+		return nil
+	}
+	multi.UseGit(st, changedonly)
+	return nil
+}
+
+// SetTrace sends trace as the trace ID of the query with the requests of
+// ris and the RemoteInternalSearchers and FileCaches made from it.
+func (ris *RemoteInternalSearcher) SetTrace(trace string) {
+	ris.trace = trace
+}
+
+// RewriteEntries rewrites the paths in the Arg and Uid of the entries
+// found on a project's server with rules so that they name the files
+// where the client can find them.
+func RewriteEntries(entries []output.Entry, rules []base.Rewrite) []output.Entry {
+	if len(rules) == 0 {
+		return entries
+	}
+	for i := range entries {
+		entries[i].Uid = base.RewritePath(rules, entries[i].Uid)
+		entries[i].Arg = rewriteArg(rules, entries[i].Arg)
+	}
+	return entries
+}
+
+// rewriteArg rewrites the path in an Arg that might be encoded with a
+// line number after base.Prefix.
+func rewriteArg(rules []base.Rewrite, arg string) string {
+	head, path := splitEncoded(arg)
+	return head + base.RewritePath(rules, path)
+}
+
+// splitEncoded divides an Arg into the encoded base.Prefix and line
+// number (if any) and the path of the file.
+func splitEncoded(arg string) (string, string) {
+	i := strings.Index(arg, base.Prefix+":")
+	if i < 0 {
+		return "", arg
+	}
+	j := i + len(base.Prefix) + 1
+	for j < len(arg) && arg[j] >= '0' && arg[j] <= '9' {
+		j++
+	}
+	return arg[:j], arg[j:]
+}
@@ -57,9 +57,9 @@ func leapIntegrationTestBeforeReindex(t *testing.T, leapserver *rpc.Client, itd
 					},
 					Uid:          filepath.Join(itd.root, "remote/one"),
 					Arg:          filepath.Join(itd.root, "remote/one"),
-					Type:         "file",
+					Type:         "file:skipcheck",
 					Valid:        "",
-					AutoComplete: "",
+					AutoComplete: "one",
 					Title:        "one",
 					SubTitle:     "remote/one",
 					Icon: output.AlfredIcon{
@@ -134,9 +134,9 @@ func leapIntegrationTestAfterReindex(t *testing.T, leapserver *rpc.Client, itd *
 					},
 					Uid:          filepath.Join(itd.root, "remote/one"),
 					Arg:          filepath.Join(itd.root, "remote/one"),
-					Type:         "file",
+					Type:         "file:skipcheck",
 					Valid:        "",
-					AutoComplete: "",
+					AutoComplete: "one",
 					Title:        "one",
 					SubTitle:     "remote/one",
 					Icon: output.AlfredIcon{
@@ -188,9 +188,9 @@ func leapIntegrationTestAfterReindex(t *testing.T, leapserver *rpc.Client, itd *
 					},
 					Uid:          filepath.Join(itd.root, "remote/newfourfile"),
 					Arg:          filepath.Join(itd.root, "remote/newfourfile"),
-					Type:         "file",
+					Type:         "file:skipcheck",
 					Valid:        "",
-					AutoComplete: "",
+					AutoComplete: "newfourfile",
 					Title:        "newfourfile",
 					SubTitle:     "remote/newfourfile",
 					Icon: output.AlfredIcon{
@@ -247,9 +247,9 @@ func leapIntegrationTestAfterShuttingDownServer(t *testing.T, leapserver *rpc.Cl
 					},
 					Uid:          filepath.Join(itd.root, "remote/one"),
 					Arg:          filepath.Join(itd.root, "remote/one"),
-					Type:         "file",
+					Type:         "file:skipcheck",
 					Valid:        "",
-					AutoComplete: "",
+					AutoComplete: "one",
 					Title:        "one",
 					SubTitle:     "remote/one",
 					Icon: output.AlfredIcon{
@@ -273,9 +273,9 @@ func leapIntegrationTestAfterShuttingDownServer(t *testing.T, leapserver *rpc.Cl
 					},
 					Uid:          filepath.Join(itd.root, "remote/newfourfile"),
 					Arg:          filepath.Join(itd.root, "remote/newfourfile"),
-					Type:         "file",
+					Type:         "file:skipcheck",
 					Valid:        "",
-					AutoComplete: "",
+					AutoComplete: "newfourfile",
 					Title:        "newfourfile",
 					SubTitle:     "remote/newfourfile",
 					Icon: output.AlfredIcon{
@@ -287,3 +287,39 @@ func leapIntegrationTestAfterShuttingDownServer(t *testing.T, leapserver *rpc.Cl
 		},
 	})
 }
+
+func TestRewriteEntries(t *testing.T) {
+	rules := []base.Rewrite{{From: "/home/build/src", To: "/n/remote/src"}}
+	entries := []output.Entry{
+		{
+			Uid: "/home/build/src/a/b.go",
+			Arg: "/home/build/src/a/b.go:12",
+		},
+		{
+			Uid: "/home/build/src/a/b.go:7",
+			Arg: "/" + base.Prefix + ":7/home/build/src/a/b.go",
+		},
+		{
+			Uid: "/elsewhere/c.go",
+			Arg: "/elsewhere/c.go",
+		},
+	}
+	want := []output.Entry{
+		{
+			Uid: "/n/remote/src/a/b.go",
+			Arg: "/n/remote/src/a/b.go:12",
+		},
+		{
+			Uid: "/n/remote/src/a/b.go:7",
+			Arg: "/" + base.Prefix + ":7/n/remote/src/a/b.go",
+		},
+		{
+			Uid: "/elsewhere/c.go",
+			Arg: "/elsewhere/c.go",
+		},
+	}
+
+	if got := RewriteEntries(entries, rules); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %s, want %s", litter.Sdump(got), litter.Sdump(want))
+	}
+}
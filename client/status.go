@@ -0,0 +1,74 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rjkroege/leap/base"
+	"github.com/rjkroege/leap/server"
+)
+
+// StatusTimeout bounds how long Status waits for a server so that a
+// wedged or unreachable server doesn't hang leap -status.
+const StatusTimeout = 5 * time.Second
+
+// Status fetches the status of the server of the project described by
+// config.
+func Status(config *base.Configuration) (*server.Status, error) {
+	client := &http.Client{Timeout: StatusTimeout}
+	return statusImpl(client.Get, "http://"+config.Hostname+":1234/status")
+}
+
+func statusImpl(get func(string) (*http.Response, error), url string) (*server.Status, error) {
+	resp, err := get(url)
+	if err != nil {
+		return nil, fmt.Errorf("can't get server status: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("can't get server status: %s", resp.Status)
+	}
+	st := new(server.Status)
+	if err := json.NewDecoder(resp.Body).Decode(st); err != nil {
+		return nil, fmt.Errorf("bad server status: %v", err)
+	}
+	return st, nil
+}
+
+// PrintStatus writes st to w for people to read.
+func PrintStatus(w io.Writer, st *server.Status) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	age := func(t time.Time) time.Duration {
+		return st.Now.Sub(t).Round(time.Second)
+	}
+
+	fmt.Fprintf(tw, "up %v since %s\n", age(st.Started), st.Started.Format(time.Stamp))
+
+	fmt.Fprintf(tw, "\nindex\tage\n")
+	if len(st.Indexes) == 0 {
+		fmt.Fprintf(tw, "(none loaded)\t\n")
+	}
+	for _, ix := range st.Indexes {
+		fmt.Fprintf(tw, "%s\t%v\n", ix.Path, age(ix.Modified))
+	}
+
+	fmt.Fprintf(tw, "\nmethod\tcalls\terrors\tmean\tmax\n")
+	for _, m := range st.Methods {
+		mean := time.Duration(0)
+		if m.Count > 0 {
+			mean = m.Total / time.Duration(m.Count)
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%v\t%v\n", m.Method, m.Count, m.Errors, mean.Round(time.Microsecond), m.Max.Round(time.Microsecond))
+	}
+
+	fmt.Fprintf(tw, "\nsync token %d\n", st.Token)
+	for _, tr := range st.Transfers {
+		fmt.Fprintf(tw, "session %d transferring %s: %d of %d bytes for %v, expires in %v\n",
+			tr.Token, tr.Path, tr.Sent, tr.Size, age(tr.Started), -age(tr.Expires))
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,75 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rjkroege/leap/server"
+)
+
+func TestStatus(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	want := &server.Status{
+		Now:     now,
+		Started: now.Add(-2 * time.Hour),
+		Indexes: []server.IndexStatus{{Path: "/remote/index", Modified: now.Add(-5 * time.Minute)}},
+		Methods: []server.MethodStatus{
+			{Method: "RemoteContentSearchResult", Count: 4, Errors: 1, Total: 8 * time.Millisecond, Max: 5 * time.Millisecond},
+		},
+		Token: 7,
+		Transfers: []server.TransferStatus{
+			{Token: 7, Path: "/remote/index", Size: 100, Sent: 40, Started: now.Add(-3 * time.Second), Expires: now.Add(time.Minute)},
+		},
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/status" {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(want)
+	}))
+	defer ts.Close()
+
+	st, err := statusImpl(http.Get, ts.URL+"/status")
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if _, err := statusImpl(http.Get, ts.URL+"/elsewhere"); err == nil {
+		t.Errorf("expected an error for a missing status")
+	}
+
+	buffy := new(bytes.Buffer)
+	if err := PrintStatus(buffy, st); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	for _, line := range []string{
+		"up 2h0m0s since Jun  1 10:00:00\n",
+		"/remote/index  5m0s\n",
+		"RemoteContentSearchResult  4      1       2ms   5ms\n",
+		"sync token 7\n",
+		"session 7 transferring /remote/index: 40 of 100 bytes for 3s, expires in 1m0s\n",
+	} {
+		if !strings.Contains(buffy.String(), line) {
+			t.Errorf("status %q is missing %q", buffy.String(), line)
+		}
+	}
+}
+
+func TestStatusTimeout(t *testing.T) {
+	wedged := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-wedged
+	}))
+	defer ts.Close()
+	defer close(wedged)
+
+	client := &http.Client{Timeout: 50 * time.Millisecond}
+	if _, err := statusImpl(client.Get, ts.URL+"/status"); err == nil {
+		t.Errorf("expected an error from a wedged server")
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/rjkroege/leap/search"
+)
+
+// contextPath returns the file that relative queries such as :40 or %test
+// are relative to. It's the -context flag, else $LEAP_CONTEXT, else the
+// Acme window that ran leap (named by $winid). It's empty if there's no
+// context.
+func contextPath(flagval string, lister search.WindowLister) string {
+	if flagval != "" {
+		return flagval
+	}
+	if ctx := os.Getenv("LEAP_CONTEXT"); ctx != "" {
+		return ctx
+	}
+
+	winid, err := strconv.Atoi(os.Getenv("winid"))
+	if err != nil {
+		return ""
+	}
+	wins, err := lister.Windows()
+	if err != nil {
+		log.Println("can't find context window: ", err)
+		return ""
+	}
+	for _, w := range wins {
+		if w.ID == winid && filepath.IsAbs(w.Name) {
+			return w.Name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,619 @@
+// Package export serves the trees of a project over 9P2000 so that a
+// client can mount them (e.g. with plan9port's 9pfuse) and open the
+// files that leap finds on a server.
+//
+// The exported file system mirrors the server's: the file at /a/b on the
+// server is /a/b in the export. Only the exported roots, their contents
+// and the directories leading to them are visible. Files inside of the
+// roots can be read and, if the Server allows writes, written, created,
+// removed and renamed. Symbolic links are followed but only to files
+// inside of a root.
+package export
+
+import (
+	"fmt"
+	"hash/fnv"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"9fans.net/go/plan9"
+)
+
+// maxmsize bounds the size of the messages that the server will
+// exchange.
+const maxmsize = 64*1024 + plan9.IOHDRSZ
+
+type Server struct {
+	lock  sync.Mutex
+	roots []string
+	// real are the roots with their symbolic links evaluated.
+	real     []string
+	writable bool
+}
+
+// New makes a Server that exports the trees at roots read-only.
+func New(roots ...string) *Server {
+	s := new(Server)
+	s.AddRoots(roots...)
+	return s
+}
+
+// AddRoots exports additional trees.
+func (s *Server) AddRoots(roots ...string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+outer:
+	for _, r := range roots {
+		r = filepath.Clean(r)
+		for _, o := range s.roots {
+			if o == r {
+				continue outer
+			}
+		}
+		real, err := filepath.EvalSymlinks(r)
+		if err != nil {
+			real = r
+		}
+		s.roots = append(s.roots, r)
+		s.real = append(s.real, real)
+	}
+}
+
+// AllowWrites lets clients change the files inside of the roots.
+func (s *Server) AllowWrites() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.writable = true
+}
+
+// canwrite is true if clients may change path.
+func (s *Server) canwrite(path string) bool {
+	s.lock.Lock()
+	writable := s.writable
+	s.lock.Unlock()
+	return writable && s.inside(path)
+}
+
+// within is true if path is dir or in it.
+func within(dir, path string) bool {
+	return path == dir || strings.HasPrefix(path, strings.TrimSuffix(dir, "/")+"/")
+}
+
+// resolve returns path with its symbolic links evaluated. The directory
+// of a path that doesn't exist, as when it's being created, is resolved.
+func resolve(path string) (string, error) {
+	real, err := filepath.EvalSymlinks(path)
+	if err == nil || !os.IsNotExist(err) {
+		return real, err
+	}
+	dir, err := filepath.EvalSymlinks(filepath.Dir(path))
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, filepath.Base(path)), nil
+}
+
+// inside is true if path is one of the roots or in one of them, both as
+// named and once its symbolic links are followed.
+func (s *Server) inside(path string) bool {
+	real, err := resolve(path)
+	if err != nil {
+		return false
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	named, followed := false, false
+	for i, r := range s.roots {
+		named = named || within(r, path)
+		followed = followed || within(s.real[i], real)
+	}
+	return named && followed
+}
+
+// isroot is true if path is one of the roots.
+func (s *Server) isroot(path string) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, r := range s.roots {
+		if path == r {
+			return true
+		}
+	}
+	return false
+}
+
+// visible is true if path is inside of a root or is a directory leading
+// to one.
+func (s *Server) visible(path string) bool {
+	if s.inside(path) {
+		return true
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, r := range s.roots {
+		if path == "/" || strings.HasPrefix(r, path+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// Serve answers 9P connections made to l until l fails.
+func (s *Server) Serve(l net.Listener) error {
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go s.ServeConn(c)
+	}
+}
+
+// fid is the server's state for a client's fid.
+type fid struct {
+	path string
+	file *os.File
+	mode uint8
+
+	// Directory reads return the entries starting from dirent.
+	dirs      [][]byte
+	dirent    int
+	diroffset uint64
+}
+
+// conn is the state of one client connection.
+type conn struct {
+	s     *Server
+	rwc   io.ReadWriteCloser
+	msize uint32
+	fids  map[uint32]*fid
+}
+
+// ServeConn answers the 9P requests on rwc until it fails or is closed.
+// Requests are answered in order.
+func (s *Server) ServeConn(rwc io.ReadWriteCloser) {
+	c := &conn{
+		s:     s,
+		rwc:   rwc,
+		msize: maxmsize,
+		fids:  make(map[uint32]*fid),
+	}
+	defer c.clunkall()
+	defer rwc.Close()
+
+	for {
+		tx, err := plan9.ReadFcall(rwc)
+		if err != nil {
+			if err != io.EOF {
+				log.Println("export can't read request: ", err)
+			}
+			return
+		}
+		rx := c.handle(tx)
+		rx.Tag = tx.Tag
+		if err := plan9.WriteFcall(rwc, rx); err != nil {
+			log.Println("export can't write response: ", err)
+			return
+		}
+	}
+}
+
+func rerror(err error) *plan9.Fcall {
+	return &plan9.Fcall{Type: plan9.Rerror, Ename: err.Error()}
+}
+
+func (c *conn) handle(tx *plan9.Fcall) *plan9.Fcall {
+	switch tx.Type {
+	case plan9.Tversion:
+		return c.version(tx)
+	case plan9.Tauth:
+		return rerror(fmt.Errorf("authentication not required"))
+	case plan9.Tflush:
+		// Requests are answered in order so there is nothing to flush.
+		return &plan9.Fcall{Type: plan9.Rflush}
+	case plan9.Tattach:
+		return c.attach(tx)
+	}
+
+	f, ok := c.fids[tx.Fid]
+	if !ok {
+		return rerror(fmt.Errorf("unknown fid %d", tx.Fid))
+	}
+	switch tx.Type {
+	case plan9.Twalk:
+		return c.walk(tx, f)
+	case plan9.Topen:
+		return c.open(tx, f)
+	case plan9.Tcreate:
+		return c.create(tx, f)
+	case plan9.Tread:
+		return c.read(tx, f)
+	case plan9.Twrite:
+		return c.write(tx, f)
+	case plan9.Tclunk:
+		c.clunk(tx.Fid)
+		return &plan9.Fcall{Type: plan9.Rclunk}
+	case plan9.Tremove:
+		return c.remove(tx, f)
+	case plan9.Tstat:
+		return c.stat(f)
+	case plan9.Twstat:
+		return c.wstat(tx, f)
+	}
+	return rerror(fmt.Errorf("unsupported request type %d", tx.Type))
+}
+
+func (c *conn) version(tx *plan9.Fcall) *plan9.Fcall {
+	c.clunkall()
+	if tx.Msize < c.msize {
+		c.msize = tx.Msize
+	}
+	version := "unknown"
+	if strings.HasPrefix(tx.Version, plan9.VERSION9P) {
+		version = plan9.VERSION9P
+	}
+	return &plan9.Fcall{Type: plan9.Rversion, Msize: c.msize, Version: version}
+}
+
+func (c *conn) attach(tx *plan9.Fcall) *plan9.Fcall {
+	if _, ok := c.fids[tx.Fid]; ok {
+		return rerror(fmt.Errorf("fid %d in use", tx.Fid))
+	}
+	fi, err := os.Stat("/")
+	if err != nil {
+		return rerror(err)
+	}
+	c.fids[tx.Fid] = &fid{path: "/"}
+	return &plan9.Fcall{Type: plan9.Rattach, Qid: qid("/", fi)}
+}
+
+func (c *conn) walk(tx *plan9.Fcall, f *fid) *plan9.Fcall {
+	if f.file != nil {
+		return rerror(fmt.Errorf("can't walk an open fid"))
+	}
+	if _, ok := c.fids[tx.Newfid]; ok && tx.Newfid != tx.Fid {
+		return rerror(fmt.Errorf("fid %d in use", tx.Newfid))
+	}
+
+	path := f.path
+	qids := make([]plan9.Qid, 0, len(tx.Wname))
+	for _, name := range tx.Wname {
+		var next string
+		switch {
+		case name == "..":
+			next = filepath.Dir(path)
+		case name == "." || name == "" || strings.Contains(name, "/"):
+			next = ""
+		default:
+			next = filepath.Join(path, name)
+		}
+
+		var fi os.FileInfo
+		err := fmt.Errorf("file does not exist")
+		if next != "" && c.s.visible(next) {
+			fi, err = os.Stat(next)
+		}
+		if err != nil {
+			if len(qids) == 0 {
+				return rerror(err)
+			}
+			// A partial walk doesn't move the newfid.
+			return &plan9.Fcall{Type: plan9.Rwalk, Wqid: qids}
+		}
+		path = next
+		qids = append(qids, qid(path, fi))
+	}
+
+	if tx.Newfid == tx.Fid {
+		f.path = path
+	} else {
+		c.fids[tx.Newfid] = &fid{path: path}
+	}
+	return &plan9.Fcall{Type: plan9.Rwalk, Wqid: qids}
+}
+
+// openflags converts a 9P open mode into os.OpenFile flags.
+func openflags(mode uint8) int {
+	var flags int
+	switch mode & 3 {
+	case plan9.OREAD, plan9.OEXEC:
+		flags = os.O_RDONLY
+	case plan9.OWRITE:
+		flags = os.O_WRONLY
+	case plan9.ORDWR:
+		flags = os.O_RDWR
+	}
+	if mode&plan9.OTRUNC != 0 {
+		flags |= os.O_TRUNC
+	}
+	return flags
+}
+
+// writes is true if the open mode permits changing the file.
+func writes(mode uint8) bool {
+	return mode&3 == plan9.OWRITE || mode&3 == plan9.ORDWR || mode&(plan9.OTRUNC|plan9.ORCLOSE) != 0
+}
+
+func (c *conn) open(tx *plan9.Fcall, f *fid) *plan9.Fcall {
+	if f.file != nil {
+		return rerror(fmt.Errorf("fid already open"))
+	}
+	if writes(tx.Mode) && !c.s.canwrite(f.path) {
+		return rerror(fmt.Errorf("permission denied"))
+	}
+
+	fi, err := os.Stat(f.path)
+	if err != nil {
+		return rerror(err)
+	}
+	flags := openflags(tx.Mode)
+	if fi.IsDir() {
+		if tx.Mode&3 != plan9.OREAD || tx.Mode&plan9.OTRUNC != 0 {
+			return rerror(fmt.Errorf("is a directory"))
+		}
+		flags = os.O_RDONLY
+	}
+
+	file, err := os.OpenFile(f.path, flags, 0)
+	if err != nil {
+		return rerror(err)
+	}
+	f.file = file
+	f.mode = tx.Mode
+	return &plan9.Fcall{Type: plan9.Ropen, Qid: qid(f.path, fi), Iounit: c.msize - plan9.IOHDRSZ}
+}
+
+func (c *conn) create(tx *plan9.Fcall, f *fid) *plan9.Fcall {
+	if f.file != nil {
+		return rerror(fmt.Errorf("fid already open"))
+	}
+	if tx.Name == "." || tx.Name == ".." || tx.Name == "" || strings.Contains(tx.Name, "/") {
+		return rerror(fmt.Errorf("bad file name %q", tx.Name))
+	}
+	path := filepath.Join(f.path, tx.Name)
+	if !c.s.canwrite(path) {
+		return rerror(fmt.Errorf("permission denied"))
+	}
+
+	perm := os.FileMode(tx.Perm & 0777)
+	var file *os.File
+	var err error
+	if tx.Perm&plan9.DMDIR != 0 {
+		if err := os.Mkdir(path, perm); err != nil {
+			return rerror(err)
+		}
+		file, err = os.Open(path)
+	} else {
+		file, err = os.OpenFile(path, openflags(tx.Mode)|os.O_CREATE|os.O_EXCL, perm)
+	}
+	if err != nil {
+		return rerror(err)
+	}
+	fi, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return rerror(err)
+	}
+
+	f.path = path
+	f.file = file
+	f.mode = tx.Mode
+	return &plan9.Fcall{Type: plan9.Rcreate, Qid: qid(path, fi), Iounit: c.msize - plan9.IOHDRSZ}
+}
+
+func (c *conn) read(tx *plan9.Fcall, f *fid) *plan9.Fcall {
+	if f.file == nil {
+		return rerror(fmt.Errorf("fid not open"))
+	}
+	count := tx.Count
+	if max := c.msize - plan9.IOHDRSZ; count > max {
+		count = max
+	}
+
+	fi, err := f.file.Stat()
+	if err != nil {
+		return rerror(err)
+	}
+	if !fi.IsDir() {
+		buf := make([]byte, count)
+		n, err := f.file.ReadAt(buf, int64(tx.Offset))
+		if err != nil && err != io.EOF {
+			return rerror(err)
+		}
+		return &plan9.Fcall{Type: plan9.Rread, Data: buf[:n]}
+	}
+
+	switch {
+	case tx.Offset == 0:
+		if err := c.readdir(f); err != nil {
+			return rerror(err)
+		}
+	case tx.Offset != f.diroffset:
+		return rerror(fmt.Errorf("bad directory read offset"))
+	}
+	data := make([]byte, 0, count)
+	for f.dirent < len(f.dirs) && len(data)+len(f.dirs[f.dirent]) <= int(count) {
+		data = append(data, f.dirs[f.dirent]...)
+		f.dirent++
+	}
+	f.diroffset += uint64(len(data))
+	return &plan9.Fcall{Type: plan9.Rread, Data: data}
+}
+
+// readdir loads the visible entries of the directory f.
+func (c *conn) readdir(f *fid) error {
+	des, err := os.ReadDir(f.path)
+	if err != nil {
+		return err
+	}
+	f.dirs = f.dirs[:0]
+	f.dirent = 0
+	f.diroffset = 0
+	for _, de := range des {
+		path := filepath.Join(f.path, de.Name())
+		if !c.s.visible(path) {
+			continue
+		}
+		fi, err := os.Stat(path)
+		if err != nil {
+			// A dangling symlink or a concurrently removed file.
+			continue
+		}
+		b, err := dir(path, fi).Bytes()
+		if err != nil {
+			return err
+		}
+		f.dirs = append(f.dirs, b)
+	}
+	return nil
+}
+
+func (c *conn) write(tx *plan9.Fcall, f *fid) *plan9.Fcall {
+	if f.file == nil || (f.mode&3 != plan9.OWRITE && f.mode&3 != plan9.ORDWR) {
+		return rerror(fmt.Errorf("fid not open for writing"))
+	}
+	n, err := f.file.WriteAt(tx.Data, int64(tx.Offset))
+	if err != nil {
+		return rerror(err)
+	}
+	return &plan9.Fcall{Type: plan9.Rwrite, Count: uint32(n)}
+}
+
+func (c *conn) clunk(id uint32) {
+	f, ok := c.fids[id]
+	if !ok {
+		return
+	}
+	delete(c.fids, id)
+	if f.file != nil {
+		f.file.Close()
+		if f.mode&plan9.ORCLOSE != 0 {
+			os.Remove(f.path)
+		}
+	}
+}
+
+func (c *conn) clunkall() {
+	for id := range c.fids {
+		c.clunk(id)
+	}
+}
+
+func (c *conn) remove(tx *plan9.Fcall, f *fid) *plan9.Fcall {
+	path := f.path
+	c.clunk(tx.Fid)
+	if !c.s.canwrite(path) || c.s.isroot(path) {
+		return rerror(fmt.Errorf("permission denied"))
+	}
+	if err := os.Remove(path); err != nil {
+		return rerror(err)
+	}
+	return &plan9.Fcall{Type: plan9.Rremove}
+}
+
+func (c *conn) stat(f *fid) *plan9.Fcall {
+	fi, err := os.Stat(f.path)
+	if err != nil {
+		return rerror(err)
+	}
+	b, err := dir(f.path, fi).Bytes()
+	if err != nil {
+		return rerror(err)
+	}
+	return &plan9.Fcall{Type: plan9.Rstat, Stat: b}
+}
+
+// wstat changes the name, length, permissions or modification time of
+// the file. Fields of the Dir that are "don't touch" values are left
+// alone.
+func (c *conn) wstat(tx *plan9.Fcall, f *fid) *plan9.Fcall {
+	if !c.s.canwrite(f.path) {
+		return rerror(fmt.Errorf("permission denied"))
+	}
+	d, err := plan9.UnmarshalDir(tx.Stat)
+	if err != nil {
+		return rerror(err)
+	}
+	var null plan9.Dir
+	null.Null()
+
+	if d.Length != null.Length {
+		if err := os.Truncate(f.path, int64(d.Length)); err != nil {
+			return rerror(err)
+		}
+	}
+	if d.Mode != null.Mode {
+		if err := os.Chmod(f.path, os.FileMode(d.Mode&0777)); err != nil {
+			return rerror(err)
+		}
+	}
+	if d.Mtime != null.Mtime {
+		mtime := time.Unix(int64(d.Mtime), 0)
+		if err := os.Chtimes(f.path, mtime, mtime); err != nil {
+			return rerror(err)
+		}
+	}
+	if d.Name != "" && d.Name != filepath.Base(f.path) {
+		// Renames stay in the same directory.
+		if strings.Contains(d.Name, "/") || d.Name == "." || d.Name == ".." || c.s.isroot(f.path) {
+			return rerror(fmt.Errorf("bad file name %q", d.Name))
+		}
+		path := filepath.Join(filepath.Dir(f.path), d.Name)
+		if err := os.Rename(f.path, path); err != nil {
+			return rerror(err)
+		}
+		f.path = path
+	}
+	return &plan9.Fcall{Type: plan9.Rwstat}
+}
+
+// qid makes a Qid for the file at path. The Qid's path is a hash of the
+// file's path and its version comes from the modification time.
+func qid(path string, fi os.FileInfo) plan9.Qid {
+	h := fnv.New64a()
+	h.Write([]byte(path))
+	q := plan9.Qid{
+		Path: h.Sum64(),
+		Vers: uint32(fi.ModTime().Unix()),
+		Type: plan9.QTFILE,
+	}
+	if fi.IsDir() {
+		q.Type = plan9.QTDIR
+	}
+	return q
+}
+
+// owner is the user reported as owning every file.
+func owner() string {
+	if u := os.Getenv("USER"); u != "" {
+		return u
+	}
+	return "none"
+}
+
+// dir converts the os.FileInfo of the file at path into a Dir.
+func dir(path string, fi os.FileInfo) *plan9.Dir {
+	d := &plan9.Dir{
+		Qid:    qid(path, fi),
+		Mode:   plan9.Perm(fi.Mode().Perm()),
+		Atime:  uint32(fi.ModTime().Unix()),
+		Mtime:  uint32(fi.ModTime().Unix()),
+		Length: uint64(fi.Size()),
+		Name:   filepath.Base(path),
+		Uid:    owner(),
+		Gid:    owner(),
+		Muid:   owner(),
+	}
+	if fi.IsDir() {
+		d.Mode |= plan9.DMDIR
+		d.Length = 0
+	}
+	return d
+}
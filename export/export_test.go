@@ -0,0 +1,219 @@
+package export
+
+import (
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"9fans.net/go/plan9"
+	"9fans.net/go/plan9/client"
+)
+
+// mount makes a tree with an exported root and a sibling that isn't and
+// returns a client connection to an export of the root. The root has a
+// symbolic link, escape, to the sibling.
+func mount(t *testing.T, writable bool) (*client.Fsys, string) {
+	top := t.TempDir()
+	root := filepath.Join(top, "proj")
+	for name, contents := range map[string]string{
+		"proj/a.go":     "package a\n",
+		"proj/sub/b.go": "package sub\n",
+		"secret/key":    "hunter2\n",
+	} {
+		p := filepath.Join(top, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := os.Symlink(filepath.Join(top, "secret"), filepath.Join(root, "escape")); err != nil {
+		t.Fatal(err)
+	}
+
+	s := New(root)
+	if writable {
+		s.AllowWrites()
+	}
+	cl, sv := net.Pipe()
+	go s.ServeConn(sv)
+
+	conn, err := client.NewConn(cl)
+	if err != nil {
+		t.Fatalf("can't make 9P connection: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	fsys, err := conn.Attach(nil, "gopher", "")
+	if err != nil {
+		t.Fatalf("can't attach: %v", err)
+	}
+	return fsys, root
+}
+
+func readFile(fsys *client.Fsys, name string) (string, error) {
+	fid, err := fsys.Open(name, plan9.OREAD)
+	if err != nil {
+		return "", err
+	}
+	defer fid.Close()
+	b, err := io.ReadAll(fid)
+	return string(b), err
+}
+
+func TestExportRead(t *testing.T) {
+	fsys, root := mount(t, false)
+
+	got, err := readFile(fsys, filepath.Join(root, "sub/b.go"))
+	if err != nil {
+		t.Fatalf("can't read: %v", err)
+	}
+	if want := "package sub\n"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+
+	if _, err := readFile(fsys, filepath.Join(root, "../secret/key")); err == nil {
+		t.Errorf("read a file outside of the export")
+	}
+}
+
+func TestExportDirectories(t *testing.T) {
+	fsys, root := mount(t, false)
+
+	list := func(name string) []string {
+		fid, err := fsys.Open(name, plan9.OREAD)
+		if err != nil {
+			t.Fatalf("can't open %s: %v", name, err)
+		}
+		defer fid.Close()
+		// Fid.Dirread discards short reads so unpack the entries here.
+		b, err := io.ReadAll(fid)
+		if err != nil {
+			t.Fatalf("can't read %s: %v", name, err)
+		}
+		names := make([]string, 0)
+		for len(b) > 2 {
+			n := int(b[0]) | int(b[1])<<8 + 2
+			d, err := plan9.UnmarshalDir(b[:n])
+			if err != nil {
+				t.Fatalf("bad entry in %s: %v", name, err)
+			}
+			names = append(names, d.Name)
+			b = b[n:]
+		}
+		sort.Strings(names)
+		return names
+	}
+
+	// The parent of the root only shows the root.
+	if got, want := strings.Join(list(filepath.Dir(root)), " "), "proj"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+	if got, want := strings.Join(list(root), " "), "a.go sub"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+
+	d, err := fsys.Stat(filepath.Join(root, "sub"))
+	if err != nil {
+		t.Fatalf("can't stat: %v", err)
+	}
+	if d.Mode&plan9.DMDIR == 0 || d.Qid.Type&plan9.QTDIR == 0 {
+		t.Errorf("sub isn't a directory: %v", d)
+	}
+}
+
+func TestExportWrite(t *testing.T) {
+	fsys, root := mount(t, true)
+
+	name := filepath.Join(root, "new.go")
+	fid, err := fsys.Create(name, plan9.OWRITE, 0644)
+	if err != nil {
+		t.Fatalf("can't create: %v", err)
+	}
+	if _, err := fid.Write([]byte("package new\n")); err != nil {
+		t.Fatalf("can't write: %v", err)
+	}
+	fid.Close()
+
+	if got, err := os.ReadFile(name); err != nil || string(got) != "package new\n" {
+		t.Errorf("got %q, %v", got, err)
+	}
+
+	// Rename it.
+	d := new(plan9.Dir)
+	d.Null()
+	d.Name = "renamed.go"
+	if err := fsys.Wstat(name, d); err != nil {
+		t.Fatalf("can't rename: %v", err)
+	}
+	renamed := filepath.Join(root, "renamed.go")
+	if _, err := os.Stat(renamed); err != nil {
+		t.Errorf("rename failed: %v", err)
+	}
+
+	if err := fsys.Remove(renamed); err != nil {
+		t.Fatalf("can't remove: %v", err)
+	}
+	if _, err := os.Stat(renamed); !os.IsNotExist(err) {
+		t.Errorf("remove failed: %v", err)
+	}
+
+	// Can't write outside of the root.
+	if _, err := fsys.Create(filepath.Join(filepath.Dir(root), "evil"), plan9.OWRITE, 0644); err == nil {
+		t.Errorf("created a file outside of the export")
+	}
+	if err := fsys.Remove(root); err == nil {
+		t.Errorf("removed the root")
+	}
+}
+
+func TestExportReadOnly(t *testing.T) {
+	fsys, root := mount(t, false)
+
+	if _, err := fsys.Create(filepath.Join(root, "new.go"), plan9.OWRITE, 0644); err == nil {
+		t.Errorf("created a file in a read-only export")
+	}
+	if _, err := fsys.Open(filepath.Join(root, "a.go"), plan9.OWRITE); err == nil {
+		t.Errorf("opened a file for writing in a read-only export")
+	}
+	if _, err := fsys.Open(filepath.Join(root, "a.go"), plan9.OREAD|plan9.ORCLOSE); err == nil {
+		t.Errorf("opened a file to remove on close in a read-only export")
+	}
+	if err := fsys.Remove(filepath.Join(root, "a.go")); err == nil {
+		t.Errorf("removed a file in a read-only export")
+	}
+	if _, err := os.Stat(filepath.Join(root, "a.go")); err != nil {
+		t.Errorf("a.go changed: %v", err)
+	}
+}
+
+func TestExportSymlinkEscape(t *testing.T) {
+	fsys, root := mount(t, true)
+	escape := filepath.Join(root, "escape")
+
+	// Links inside of the root are followed.
+	if err := os.Symlink(filepath.Join(root, "sub"), filepath.Join(root, "inner")); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := readFile(fsys, filepath.Join(root, "inner", "b.go")); err != nil || got != "package sub\n" {
+		t.Errorf("read through a link inside of the export got %q, %v", got, err)
+	}
+
+	if _, err := readFile(fsys, filepath.Join(escape, "key")); err == nil {
+		t.Errorf("read a file outside of the export through a symbolic link")
+	}
+	if _, err := fsys.Stat(escape); err == nil {
+		t.Errorf("symbolic link out of the export is visible")
+	}
+	if _, err := fsys.Create(filepath.Join(escape, "evil"), plan9.OWRITE, 0644); err == nil {
+		t.Errorf("created a file outside of the export through a symbolic link")
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(root), "secret", "evil")); !os.IsNotExist(err) {
+		t.Errorf("evil was created: %v", err)
+	}
+}
@@ -0,0 +1,190 @@
+// Package git summarizes the state of the git working trees that
+// contain the indexed roots so that search can prefer files that are
+// actively being worked on.
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+
+	"github.com/codeskyblue/go-sh"
+)
+
+// Ranks of a file. Smaller is more interesting.
+const (
+	Modified = iota
+	OnBranch
+	Recent
+	Untouched
+)
+
+// How far back in the log to look for recently committed files.
+const recentcommits = 10
+
+// Status records the absolute paths of files with git activity.
+type Status struct {
+	modified map[string]bool
+	branch   map[string]bool
+	recent   map[string]bool
+}
+
+// Runner lets me mock out the use of the git command.
+type Runner interface {
+	Git(dir string, args ...string) ([]byte, error)
+}
+
+// Cmd is the Runner that shells out to git. git has to be in the path.
+type Cmd struct{}
+
+func (_ Cmd) Git(dir string, args ...string) ([]byte, error) {
+	session := sh.NewSession()
+	session.SetDir(dir)
+	session.Stderr = nil
+	output, err := session.Command("git", args).Output()
+	if err != nil {
+		return nil, fmt.Errorf("can't run git %s in %s because: %v", strings.Join(args, " "), dir, err)
+	}
+	return output, nil
+}
+
+// NewStatus makes an empty Status.
+func NewStatus() *Status {
+	return &Status{
+		modified: make(map[string]bool),
+		branch:   make(map[string]bool),
+		recent:   make(map[string]bool),
+	}
+}
+
+// Add records that the file at absolute path name has the given rank.
+func (st *Status) Add(name string, rank int) {
+	switch rank {
+	case Modified:
+		st.modified[name] = true
+	case OnBranch:
+		st.branch[name] = true
+	case Recent:
+		st.recent[name] = true
+	}
+}
+
+// Read builds a Status for the git working trees containing roots.
+// Roots that are not in a git working tree are skipped.
+func Read(r Runner, roots []string) *Status {
+	st := NewStatus()
+	seen := make(map[string]bool)
+	for _, root := range roots {
+		out, err := r.Git(root, "rev-parse", "--show-toplevel")
+		if err != nil {
+			log.Printf("git.Read skipping %s: %v", root, err)
+			continue
+		}
+		top := strings.TrimSpace(string(out))
+		if seen[top] {
+			continue
+		}
+		seen[top] = true
+		st.addTree(r, top)
+	}
+	return st
+}
+
+// addTree adds the git activity in the working tree rooted at top.
+func (st *Status) addTree(r Runner, top string) {
+	if out, err := r.Git(top, "status", "--porcelain", "--untracked-files=all"); err == nil {
+		for _, l := range lines(out) {
+			// Porcelain lines are XY<space>path or XY<space>old -> new.
+			if len(l) < 4 {
+				continue
+			}
+			p := l[3:]
+			if i := strings.Index(p, " -> "); i >= 0 {
+				p = p[i+4:]
+			}
+			st.modified[filepath.Join(top, strings.Trim(p, "\""))] = true
+		}
+	} else {
+		log.Println("git status failed:", err)
+	}
+
+	if base := mergeBase(r, top); base != "" {
+		if out, err := r.Git(top, "diff", "--name-only", base, "HEAD"); err == nil {
+			for _, l := range lines(out) {
+				st.branch[filepath.Join(top, l)] = true
+			}
+		}
+	}
+
+	if out, err := r.Git(top, "log", fmt.Sprintf("-%d", recentcommits), "--name-only", "--pretty=format:"); err == nil {
+		for _, l := range lines(out) {
+			st.recent[filepath.Join(top, l)] = true
+		}
+	}
+}
+
+// mergeBase finds where the current branch diverged from its upstream
+// (or from the conventional trunk branches) or "" if it can't.
+func mergeBase(r Runner, top string) string {
+	for _, trunk := range []string{"@{upstream}", "main", "master"} {
+		out, err := r.Git(top, "merge-base", "HEAD", trunk)
+		if err != nil {
+			continue
+		}
+		return strings.TrimSpace(string(out))
+	}
+	return ""
+}
+
+func lines(out []byte) []string {
+	ls := make([]string, 0)
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		if l := scanner.Text(); strings.TrimSpace(l) != "" {
+			ls = append(ls, l)
+		}
+	}
+	return ls
+}
+
+// Rank returns how interesting the file at absolute path name is.
+func (st *Status) Rank(name string) int {
+	switch {
+	case st == nil:
+		return Untouched
+	case st.modified[name]:
+		return Modified
+	case st.branch[name]:
+		return OnBranch
+	case st.recent[name]:
+		return Recent
+	}
+	return Untouched
+}
+
+// Files returns the Rank of every file with git activity so that a
+// Status can be sent elsewhere and rebuilt with Add.
+func (st *Status) Files() map[string]int {
+	files := make(map[string]int)
+	if st == nil {
+		return files
+	}
+	for _, ranked := range []struct {
+		names map[string]bool
+		rank  int
+	}{{st.recent, Recent}, {st.branch, OnBranch}, {st.modified, Modified}} {
+		for name := range ranked.names {
+			files[name] = ranked.rank
+		}
+	}
+	return files
+}
+
+// Changed is true if name has been modified in the working tree or on
+// the current branch.
+func (st *Status) Changed(name string) bool {
+	return st.Rank(name) < Recent
+}
@@ -0,0 +1,130 @@
+package git
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// makeTestRepo builds a git repository with a main branch containing
+// old and committed, a feature branch that adds branched and a working
+// tree where committed has been edited and untracked has been added.
+func makeTestRepo(t *testing.T) string {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not available")
+	}
+	root := t.TempDir()
+
+	run := func(args ...string) {
+		cmd := exec.Command("git", append([]string{
+			"-c", "user.name=gopher",
+			"-c", "user.email=gopher@example.com",
+			"-c", "commit.gpgsign=false",
+		}, args...)...)
+		cmd.Dir = root
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %v\n%s", args, err, out)
+		}
+	}
+	write := func(name, contents string) {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(contents), 0644); err != nil {
+			t.Fatalf("can't write %s: %v", name, err)
+		}
+	}
+
+	run("init", "-q", "-b", "main")
+	write("old", "old\n")
+	run("add", "old")
+	run("commit", "-q", "-m", "old")
+
+	// Push old out of the recent commit window.
+	for i := 0; i < recentcommits; i++ {
+		run("commit", "-q", "--allow-empty", "-m", "empty")
+	}
+
+	write("committed", "committed\n")
+	run("add", "committed")
+	run("commit", "-q", "-m", "committed")
+
+	run("checkout", "-q", "-b", "feature")
+	write("branched", "branched\n")
+	run("add", "branched")
+	run("commit", "-q", "-m", "branched")
+
+	write("committed", "edited\n")
+	write("untracked", "untracked\n")
+	return root
+}
+
+func TestRead(t *testing.T) {
+	root := makeTestRepo(t)
+	// Resolve symlinks in the temp path to match git's idea of the top.
+	root, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		t.Fatalf("can't resolve %s: %v", root, err)
+	}
+
+	st := Read(Cmd{}, []string{root, filepath.Join(root, "not-a-dir")})
+
+	for _, tv := range []struct {
+		name    string
+		rank    int
+		changed bool
+	}{
+		{"committed", Modified, true},
+		{"untracked", Modified, true},
+		{"branched", OnBranch, true},
+		{"old", Untouched, false},
+		{"missing", Untouched, false},
+	} {
+		p := filepath.Join(root, tv.name)
+		if got, want := st.Rank(p), tv.rank; got != want {
+			t.Errorf("Rank(%s) got %d want %d", tv.name, got, want)
+		}
+		if got, want := st.Changed(p), tv.changed; got != want {
+			t.Errorf("Changed(%s) got %v want %v", tv.name, got, want)
+		}
+	}
+}
+
+func TestReadNotARepo(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not available")
+	}
+	st := Read(Cmd{}, []string{t.TempDir()})
+	if got, want := st.Rank("/anything"), Untouched; got != want {
+		t.Errorf("Rank got %d want %d", got, want)
+	}
+}
+
+func TestNilStatus(t *testing.T) {
+	var st *Status
+	if got, want := st.Rank("/anything"), Untouched; got != want {
+		t.Errorf("Rank got %d want %d", got, want)
+	}
+}
+
+func TestFiles(t *testing.T) {
+	st := NewStatus()
+	st.Add("/a", Recent)
+	st.Add("/a", Modified)
+	st.Add("/b", OnBranch)
+
+	files := st.Files()
+	if got, want := len(files), 2; got != want {
+		t.Fatalf("Files got %v want %d files", files, want)
+	}
+	rebuilt := NewStatus()
+	for name, rank := range files {
+		rebuilt.Add(name, rank)
+	}
+	for _, name := range []string{"/a", "/b", "/c"} {
+		if got, want := rebuilt.Rank(name), st.Rank(name); got != want {
+			t.Errorf("Rank(%s) got %d want %d", name, got, want)
+		}
+	}
+	if got := (*Status)(nil).Files(); len(got) != 0 {
+		t.Errorf("nil Status has files %v", got)
+	}
+}
@@ -3,6 +3,7 @@ module github.com/rjkroege/leap
 go 1.22.4
 
 require (
+	9fans.net/go v0.0.5
 	github.com/Redundancy/go-sync v0.0.0-20160424152509-8931874cad5c
 	github.com/codeskyblue/go-sh v0.0.0-20190412065543-76bd3d59ff27
 	github.com/google/codesearch v1.1.0
@@ -11,7 +12,6 @@ require (
 )
 
 require (
-	9fans.net/go v0.0.5 // indirect
 	github.com/codegangsta/inject v0.0.0-20150114235600-33e0aa1cb7c0 // indirect
 	github.com/petar/GoLLRB v0.0.0-20190514000832-33fb24c13b99 // indirect
 )
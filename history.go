@@ -0,0 +1,54 @@
+package main
+
+import (
+	"log"
+
+	"github.com/rjkroege/leap/base"
+	"github.com/rjkroege/leap/history"
+	"github.com/rjkroege/leap/output"
+)
+
+// RecentQueries is how many queries -history lists.
+const RecentQueries = 20
+
+func recordQuery(config *base.Configuration, query string) {
+	h, err := history.ForProject(config.Project())
+	if err != nil {
+		log.Println("not recording query: ", err)
+		return
+	}
+	if err := h.AddQuery(query); err != nil {
+		log.Println("not recording query: ", err)
+	}
+}
+
+func recordChoice(config *base.Configuration, chosen string) {
+	h, err := history.ForProject(config.Project())
+	if err != nil {
+		log.Println("not recording choice: ", err)
+		return
+	}
+	if err := h.AddChoice(chosen); err != nil {
+		log.Println("not recording choice: ", err)
+	}
+}
+
+// recentQueries returns the recent queries of the project described by
+// config as results. There are none if the project doesn't keep a
+// history.
+func recentQueries(config *base.Configuration) []output.Entry {
+	if !config.History {
+		return []output.Entry{}
+	}
+	h, err := history.ForProject(config.Project())
+	if err != nil {
+		log.Println("no history: ", err)
+		return []output.Entry{}
+	}
+	recs, err := h.Records()
+	if err != nil {
+		log.Println("no history: ", err)
+		return []output.Entry{}
+	}
+	return history.Entries(history.Recent(recs, RecentQueries))
+}
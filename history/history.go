@@ -0,0 +1,160 @@
+// Package history records a project's queries and the results chosen
+// from them so that leap can offer recent searches.
+package history
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rjkroege/leap/base"
+	"github.com/rjkroege/leap/output"
+)
+
+// MaxRecords bounds the length of the history.
+const MaxRecords = 500
+
+// CollapseInterval is how soon a query must follow an unchosen query to
+// replace it. Alfred runs leap for every keystroke so only the last
+// query typed is worth keeping.
+const CollapseInterval = 30 * time.Second
+
+// Record is a query and (if one was chosen) the chosen result.
+type Record struct {
+	Time   time.Time
+	Query  string
+	Chosen string `json:",omitempty"`
+}
+
+// History is the history of a project stored in a file.
+type History struct {
+	path string
+	now  func() time.Time
+}
+
+// New makes a History stored in the file at path.
+func New(path string) *History {
+	return &History{
+		path: path,
+		now:  time.Now,
+	}
+}
+
+// ForProject returns the History of project.
+func ForProject(project string) (*History, error) {
+	if project == "" {
+		// Old style configurations have only one unnamed project.
+		project = "default"
+	}
+	return New(filepath.Join(base.StateDir(), "history", project+".json")), nil
+}
+
+// Records returns the history, oldest first.
+func (h *History) Records() ([]Record, error) {
+	b, err := os.ReadFile(h.path)
+	if os.IsNotExist(err) {
+		return []Record{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("can't read history %s: %v", h.path, err)
+	}
+	recs := make([]Record, 0)
+	if err := json.Unmarshal(b, &recs); err != nil {
+		return nil, fmt.Errorf("can't parse history %s: %v", h.path, err)
+	}
+	return recs, nil
+}
+
+// write replaces the history with recs. Concurrent invocations can lose
+// records: it's only history.
+func (h *History) write(recs []Record) error {
+	if len(recs) > MaxRecords {
+		recs = recs[len(recs)-MaxRecords:]
+	}
+	b, err := json.Marshal(recs)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(h.path), 0700); err != nil {
+		return fmt.Errorf("can't make history directory: %v", err)
+	}
+	tmp := h.path + "-temporary"
+	if err := os.WriteFile(tmp, b, 0600); err != nil {
+		return fmt.Errorf("can't write history %s: %v", h.path, err)
+	}
+	return os.Rename(tmp, h.path)
+}
+
+// AddQuery records that query was run. It replaces the previous query if
+// that was recent and nothing was chosen from it.
+func (h *History) AddQuery(query string) error {
+	recs, err := h.Records()
+	if err != nil {
+		return err
+	}
+	now := h.now()
+	if n := len(recs); n > 0 && recs[n-1].Chosen == "" && now.Sub(recs[n-1].Time) < CollapseInterval {
+		recs = recs[:n-1]
+	}
+	return h.write(append(recs, Record{Time: now, Query: query}))
+}
+
+// AddChoice records that chosen was chosen from the results of the last
+// query.
+func (h *History) AddChoice(chosen string) error {
+	recs, err := h.Records()
+	if err != nil {
+		return err
+	}
+	n := len(recs)
+	switch {
+	case n == 0:
+		recs = append(recs, Record{Time: h.now(), Chosen: chosen})
+	case recs[n-1].Chosen == "":
+		recs[n-1].Chosen = chosen
+	default:
+		// Another result of the same query.
+		recs = append(recs, Record{Time: h.now(), Query: recs[n-1].Query, Chosen: chosen})
+	}
+	return h.write(recs)
+}
+
+// Recent returns up to n of the most recent distinct queries, most recent
+// first.
+func Recent(recs []Record, n int) []Record {
+	recent := make([]Record, 0, n)
+	seen := make(map[string]bool)
+	for i := len(recs) - 1; i >= 0 && len(recent) < n; i-- {
+		r := recs[i]
+		if r.Query == "" || seen[r.Query] {
+			continue
+		}
+		seen[r.Query] = true
+		recent = append(recent, r)
+	}
+	return recent
+}
+
+// Entries makes Alfred results of recs. Choosing one runs its query
+// again.
+func Entries(recs []Record) []output.Entry {
+	oo := make([]output.Entry, 0, len(recs))
+	for _, r := range recs {
+		sub := []string{r.Time.Format("Jan 2 15:04")}
+		if r.Chosen != "" {
+			sub = append(sub, r.Chosen)
+		}
+		oo = append(oo, output.Entry{
+			Uid:          "history:" + r.Query,
+			Arg:          r.Query,
+			Valid:        "no",
+			AutoComplete: r.Query,
+			Title:        r.Query,
+			SubTitle:     strings.Join(sub, " "),
+		})
+	}
+	return oo
+}
@@ -0,0 +1,100 @@
+package history
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func makeHistory(t *testing.T) (*History, *time.Time) {
+	now := time.Date(2024, 6, 1, 10, 0, 0, 0, time.UTC)
+	h := New(filepath.Join(t.TempDir(), "history", "proj.json"))
+	h.now = func() time.Time { return now }
+	return h, &now
+}
+
+func queries(recs []Record) []string {
+	q := make([]string, 0, len(recs))
+	for _, r := range recs {
+		q = append(q, r.Query+"="+r.Chosen)
+	}
+	return q
+}
+
+func TestHistory(t *testing.T) {
+	h, now := makeHistory(t)
+
+	recs, err := h.Records()
+	if err != nil || len(recs) != 0 {
+		t.Fatalf("empty history got %v, %v", recs, err)
+	}
+
+	// Typing replaces the query.
+	for _, q := range []string{"f", "fo", "foo"} {
+		*now = now.Add(time.Second)
+		if err := h.AddQuery(q); err != nil {
+			t.Fatalf("AddQuery(%q) failed: %v", q, err)
+		}
+	}
+	if err := h.AddChoice("/a/foo.go"); err != nil {
+		t.Fatalf("AddChoice failed: %v", err)
+	}
+	if err := h.AddChoice("/a/foo_test.go"); err != nil {
+		t.Fatalf("AddChoice failed: %v", err)
+	}
+
+	// A chosen query is kept.
+	*now = now.Add(time.Second)
+	h.AddQuery("bar")
+	// As is one that was abandoned a while ago.
+	*now = now.Add(time.Minute)
+	h.AddQuery("foo")
+
+	recs, err = h.Records()
+	if err != nil {
+		t.Fatalf("Records failed: %v", err)
+	}
+	if got, want := queries(recs), []string{"foo=/a/foo.go", "foo=/a/foo_test.go", "bar=", "foo="}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v want %v", got, want)
+	}
+
+	if got, want := queries(Recent(recs, 5)), []string{"foo=", "bar="}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Recent got %v want %v", got, want)
+	}
+	if got := Recent(recs, 1); len(got) != 1 {
+		t.Errorf("Recent(1) got %d records", len(got))
+	}
+}
+
+func TestHistoryBounded(t *testing.T) {
+	h, now := makeHistory(t)
+	for i := 0; i < MaxRecords+10; i++ {
+		h.AddQuery("q")
+		h.AddChoice("c")
+		*now = now.Add(time.Second)
+	}
+	recs, err := h.Records()
+	if err != nil {
+		t.Fatalf("Records failed: %v", err)
+	}
+	if len(recs) != MaxRecords {
+		t.Errorf("got %d records want %d", len(recs), MaxRecords)
+	}
+}
+
+func TestEntries(t *testing.T) {
+	recs := []Record{{
+		Time:   time.Date(2024, 6, 1, 10, 0, 0, 0, time.UTC),
+		Query:  "foo:/bar",
+		Chosen: "/a/foo.go:12",
+	}}
+	got := Entries(recs)
+	if len(got) != 1 {
+		t.Fatalf("got %d entries", len(got))
+	}
+	e := got[0]
+	if e.Title != "foo:/bar" || e.AutoComplete != "foo:/bar" || e.Valid != "no" || e.SubTitle != "Jun 1 10:00 /a/foo.go:12" {
+		t.Errorf("unexpected entry %#v", e)
+	}
+}
@@ -0,0 +1,177 @@
+package index
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// IgnoreFiles are the files consulted (in this order) in each directory
+// for patterns of paths to leave out of the index. They have gitignore
+// semantics.
+var IgnoreFiles = []string{".gitignore", ".ignore", ".leapignore"}
+
+// rule is a single pattern from an ignore file.
+type rule struct {
+	re      *regexp.Regexp
+	negate  bool
+	dironly bool
+
+	// The directory containing the ignore file. Patterns match paths
+	// relative to it.
+	base string
+	// The ignore file that provided this rule.
+	source string
+}
+
+// ignorer holds the rules in effect for a directory: those from its
+// own ignore files appended to those of its parents.
+type ignorer struct {
+	rules []*rule
+}
+
+// parseIgnoreFile reads the ignore file at path. A missing file has no
+// rules.
+func parseIgnoreFile(path string) ([]*rule, error) {
+	fd, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+
+	rules := make([]*rule, 0)
+	scanner := bufio.NewScanner(fd)
+	for scanner.Scan() {
+		if r := parseIgnoreLine(scanner.Text()); r != nil {
+			r.base = filepath.Dir(path)
+			r.source = path
+			rules = append(rules, r)
+		}
+	}
+	return rules, scanner.Err()
+}
+
+// parseIgnoreLine converts a single gitignore pattern into a rule or
+// returns nil if the line has no pattern.
+func parseIgnoreLine(line string) *rule {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || line[0] == '#' {
+		return nil
+	}
+
+	r := new(rule)
+	switch {
+	case line[0] == '!':
+		r.negate = true
+		line = line[1:]
+	case strings.HasPrefix(line, `\!`), strings.HasPrefix(line, `\#`):
+		line = line[1:]
+	}
+
+	if strings.HasSuffix(line, "/") {
+		r.dironly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return nil
+	}
+
+	// A slash anywhere but the end anchors the pattern to the directory
+	// of the ignore file. Otherwise it matches a name at any depth.
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+
+	prefix := "^(?:.*/)?"
+	if anchored {
+		prefix = "^"
+	}
+	re, err := regexp.Compile(prefix + globToRegexp(line) + "$")
+	if err != nil {
+		return nil
+	}
+	r.re = re
+	return r
+}
+
+// globToRegexp converts gitignore glob syntax to a regexp.
+func globToRegexp(glob string) string {
+	var b strings.Builder
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch {
+		case strings.HasPrefix(glob[i:], "**/"):
+			// Zero or more directories.
+			b.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "/**") && i+3 == len(glob):
+			// Everything inside.
+			b.WriteString("/.*")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		case c == '[':
+			j := strings.IndexByte(glob[i+1:], ']')
+			if j < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+1+j]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + class + "]")
+			i += j + 1
+		case c == '\\' && i+1 < len(glob):
+			i++
+			b.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return b.String()
+}
+
+// enter returns the ignorer for the directory dir by adding the rules
+// from dir's ignore files to those of ig.
+func (ig *ignorer) enter(dir string) (*ignorer, error) {
+	nig := &ignorer{rules: ig.rules}
+	for _, name := range IgnoreFiles {
+		rules, err := parseIgnoreFile(filepath.Join(dir, name))
+		if err != nil {
+			return ig, err
+		}
+		if len(rules) > 0 {
+			// Make sure that we don't share a backing array with the parent.
+			nig.rules = append(nig.rules[:len(nig.rules):len(nig.rules)], rules...)
+		}
+	}
+	return nig, nil
+}
+
+// match reports if path should be ignored and the ignore file that made
+// that decision. The last matching rule wins.
+func (ig *ignorer) match(path string, isdir bool) (bool, string) {
+	ignored, source := false, ""
+	for _, r := range ig.rules {
+		if r.dironly && !isdir {
+			continue
+		}
+		rel, err := filepath.Rel(r.base, path)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		if r.re.MatchString(filepath.ToSlash(rel)) {
+			ignored, source = !r.negate, r.source
+		}
+	}
+	return ignored, source
+}
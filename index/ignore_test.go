@@ -0,0 +1,64 @@
+package index
+
+import (
+	"testing"
+)
+
+func TestIgnoreMatch(t *testing.T) {
+	tt := []struct {
+		pattern string
+		path    string
+		isdir   bool
+		ignored bool
+	}{
+		{"*.o", "/r/a.o", false, true},
+		{"*.o", "/r/sub/a.o", false, true},
+		{"*.o", "/r/a.c", false, false},
+		{"build/", "/r/build", true, true},
+		{"build/", "/r/build", false, false},
+		{"build/", "/r/sub/build", true, true},
+		{"/vendor", "/r/vendor", true, true},
+		{"/vendor", "/r/sub/vendor", true, false},
+		{"sub/*.txt", "/r/sub/a.txt", false, true},
+		{"sub/*.txt", "/r/other/sub/a.txt", false, false},
+		{"**/gen", "/r/x/y/gen", true, true},
+		{"docs/**", "/r/docs/a/b", false, true},
+		{"a/**/b", "/r/a/b", false, true},
+		{"a/**/b", "/r/a/x/y/b", false, true},
+		{"fo?.go", "/r/foo.go", false, true},
+		{"fo?.go", "/r/fo/.go", false, false},
+		{"[ab].go", "/r/a.go", false, true},
+		{"[!ab].go", "/r/a.go", false, false},
+		{"# comment", "/r/# comment", false, false},
+		{`\#hash`, "/r/#hash", false, true},
+		{"", "/r/a", false, false},
+	}
+
+	for _, tv := range tt {
+		ig := new(ignorer)
+		if r := parseIgnoreLine(tv.pattern); r != nil {
+			r.base = "/r"
+			ig.rules = append(ig.rules, r)
+		}
+		if got, _ := ig.match(tv.path, tv.isdir); got != tv.ignored {
+			t.Errorf("pattern %q on %s (dir %v) got %v want %v", tv.pattern, tv.path, tv.isdir, got, tv.ignored)
+		}
+	}
+}
+
+func TestIgnoreNegation(t *testing.T) {
+	ig := new(ignorer)
+	for _, p := range []string{"*.log", "!keep.log"} {
+		r := parseIgnoreLine(p)
+		r.base = "/r"
+		r.source = "/r/.gitignore"
+		ig.rules = append(ig.rules, r)
+	}
+
+	if got, source := ig.match("/r/a.log", false); !got || source != "/r/.gitignore" {
+		t.Errorf("a.log got %v, %q want true, /r/.gitignore", got, source)
+	}
+	if got, _ := ig.match("/r/keep.log", false); got {
+		t.Errorf("keep.log should not be ignored")
+	}
+}
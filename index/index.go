@@ -2,27 +2,162 @@ package index
 
 import (
 	"fmt"
+	"io/fs"
 	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 
-	"github.com/codeskyblue/go-sh"
+	"github.com/google/codesearch/index"
 )
 
 type Idx struct{}
 
-// ReIndex runs cindex to reindex the file based on the provided configuration.
-// cindex has to be in the path.
+// Stats summarizes a run of the indexer.
+type Stats struct {
+	Paths []string
+	Files int
+	// Skipped counts the files and directories left out of the index
+	// by each ignore file.
+	Skipped map[string]int
+}
+
+// String formats the Stats in the style of cindex's output.
+func (st *Stats) String() string {
+	var b strings.Builder
+	for _, p := range st.Paths {
+		fmt.Fprintf(&b, "index %s\n", p)
+	}
+	fmt.Fprintf(&b, "indexed %d files\n", st.Files)
+
+	sources := make([]string, 0, len(st.Skipped))
+	total := 0
+	for s, n := range st.Skipped {
+		sources = append(sources, s)
+		total += n
+	}
+	sort.Strings(sources)
+	fmt.Fprintf(&b, "skipped %d paths\n", total)
+	for _, s := range sources {
+		fmt.Fprintf(&b, "	%s: %d\n", s, st.Skipped[s])
+	}
+	return b.String()
+}
+
+// ReIndex indexes the trees at the given paths into the index at
+// indexpath. With no paths, it re-indexes the paths already in the
+// index. Paths matched by the IgnoreFiles are skipped. It returns a
+// report of what it did.
 // TODO(rjk): Validate the args from the client.
 // TODO(rjk): Assume less config state? It's not clear where the args should
 // come from here.
 func (_ Idx) ReIndex(indexpath string, args ...string) ([]byte, error) {
-	session := sh.NewSession()
 	log.Println("indexpath: ", indexpath)
-	session.SetEnv("CSEARCHINDEX", indexpath)
 
-	// TODO(rjk): insert argument here.
-	output, err := session.Command("cindex", args).CombinedOutput()
-	if err != nil {
-		return nil, fmt.Errorf("can't run cindex because: %v", err)
+	_, err := os.Stat(indexpath)
+	exists := err == nil
+
+	if len(args) == 0 {
+		if !exists {
+			return nil, fmt.Errorf("can't reindex %s because it doesn't exist and no paths were given", indexpath)
+		}
+		old, err := Open(indexpath)
+		if err != nil {
+			return nil, err
+		}
+		args = old.Paths()
+		old.Close()
+	}
+
+	// Like cindex, use sorted absolute paths.
+	paths := make([]string, 0, len(args))
+	for _, a := range args {
+		p, err := filepath.Abs(a)
+		if err != nil {
+			return nil, fmt.Errorf("can't make %s absolute because: %v", a, err)
+		}
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	// Like cindex, adding new paths to an existing index merges them.
+	file := indexpath
+	if exists {
+		file += "~"
 	}
-	return output, nil
+
+	stats := &Stats{
+		Paths:   paths,
+		Skipped: make(map[string]int),
+	}
+	ix := index.Create(file)
+	ix.AddPaths(paths)
+	for _, p := range paths {
+		if err := walk(ix, p, stats); err != nil {
+			return nil, fmt.Errorf("can't index %s because: %v", p, err)
+		}
+	}
+	ix.Flush()
+
+	if exists {
+		index.Merge(file+"~", indexpath, file)
+		os.Remove(file)
+		if err := os.Rename(file+"~", indexpath); err != nil {
+			return nil, fmt.Errorf("can't replace %s because: %v", indexpath, err)
+		}
+	}
+	return []byte(stats.String()), nil
+}
+
+// walk adds the files in the tree at root to ix except for those
+// excluded by ignore files, temporary or hidden files.
+func walk(ix *index.IndexWriter, root string, stats *Stats) error {
+	ignorers := map[string]*ignorer{
+		filepath.Dir(root): new(ignorer),
+	}
+
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			log.Printf("%s: %s", path, err)
+			return nil
+		}
+
+		// Skip various temporary or "hidden" files or directories.
+		if elem := d.Name(); path != root && elem != "" {
+			if elem[0] == '.' || elem[0] == '#' || elem[0] == '~' || elem[len(elem)-1] == '~' {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+		}
+
+		ig := ignorers[filepath.Dir(path)]
+		if ig == nil {
+			ig = new(ignorer)
+		}
+		if path != root {
+			if ignored, source := ig.match(path, d.IsDir()); ignored {
+				stats.Skipped[source]++
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+		}
+
+		switch {
+		case d.IsDir():
+			nig, err := ig.enter(path)
+			if err != nil {
+				log.Printf("can't read ignore files in %s: %v", path, err)
+			}
+			ignorers[path] = nig
+		case d.Type().IsRegular():
+			ix.AddFile(path)
+			stats.Files++
+		}
+		return nil
+	})
 }
@@ -0,0 +1,111 @@
+package index
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/google/codesearch/index"
+)
+
+func writeTree(t *testing.T, root string, files map[string]string) {
+	for name, contents := range files {
+		p := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatalf("can't make directory for %s: %v", p, err)
+		}
+		if err := os.WriteFile(p, []byte(contents), 0644); err != nil {
+			t.Fatalf("can't write %s: %v", p, err)
+		}
+	}
+}
+
+func indexedNames(indexpath string) []string {
+	ix := index.Open(indexpath)
+	names := make([]string, 0)
+	for _, id := range ix.PostingQuery(&index.Query{Op: index.QAll}) {
+		names = append(names, ix.Name(id))
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestReIndexHonoursIgnoreFiles(t *testing.T) {
+	root := t.TempDir()
+	tree := filepath.Join(root, "tree")
+	writeTree(t, tree, map[string]string{
+		".gitignore":        "*.o\nbuild/\n",
+		".leapignore":       "/vendor\n",
+		"main.go":           "package main\n",
+		"main.o":            "object\n",
+		"build/out.go":      "package out\n",
+		"vendor/dep/dep.go": "package dep\n",
+		"sub/.ignore":       "*.txt\n!keep.txt\n",
+		"sub/notes.txt":     "notes\n",
+		"sub/keep.txt":      "keep\n",
+		"sub/vendor/v.go":   "package v\n",
+		".hidden/secret.go": "package secret\n",
+	})
+	indexpath := filepath.Join(root, "index")
+
+	out, err := Idx{}.ReIndex(indexpath, tree)
+	if err != nil {
+		t.Fatalf("ReIndex failed: %v", err)
+	}
+
+	want := []string{
+		filepath.Join(tree, "main.go"),
+		filepath.Join(tree, "sub/keep.txt"),
+		filepath.Join(tree, "sub/vendor/v.go"),
+	}
+	if got := indexedNames(indexpath); !reflect.DeepEqual(got, want) {
+		t.Errorf("indexed got %v want %v", got, want)
+	}
+
+	report := string(out)
+	for _, s := range []string{
+		"indexed 3 files",
+		"skipped 4 paths",
+		filepath.Join(tree, ".gitignore") + ": 2",
+		filepath.Join(tree, ".leapignore") + ": 1",
+		filepath.Join(tree, "sub/.ignore") + ": 1",
+	} {
+		if !strings.Contains(report, s) {
+			t.Errorf("report %q missing %q", report, s)
+		}
+	}
+}
+
+func TestReIndexExistingPaths(t *testing.T) {
+	root := t.TempDir()
+	tree := filepath.Join(root, "tree")
+	writeTree(t, tree, map[string]string{
+		"a.go": "package a\n",
+	})
+	indexpath := filepath.Join(root, "index")
+
+	if _, err := (Idx{}).ReIndex(indexpath, tree); err != nil {
+		t.Fatalf("ReIndex failed: %v", err)
+	}
+	writeTree(t, tree, map[string]string{
+		"b.go": "package b\n",
+	})
+
+	// No paths means re-index what's already there.
+	if _, err := (Idx{}).ReIndex(indexpath); err != nil {
+		t.Fatalf("ReIndex failed: %v", err)
+	}
+	want := []string{filepath.Join(tree, "a.go"), filepath.Join(tree, "b.go")}
+	if got := indexedNames(indexpath); !reflect.DeepEqual(got, want) {
+		t.Errorf("indexed got %v want %v", got, want)
+	}
+}
+
+func TestReIndexMissingIndex(t *testing.T) {
+	if _, err := (Idx{}).ReIndex(filepath.Join(t.TempDir(), "index")); err == nil {
+		t.Errorf("expected error re-indexing a missing index without paths")
+	}
+}
@@ -0,0 +1,22 @@
+//go:build !unix
+
+package index
+
+import (
+	"io"
+	"os"
+)
+
+// mmapFile reads f into memory where leap doesn't map files.
+func mmapFile(f *os.File) (mmapData, error) {
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return mmapData{}, err
+	}
+	return mmapData{f, data}, nil
+}
+
+// munmap releases data returned by mmapFile.
+func munmap(data []byte) error {
+	return nil
+}
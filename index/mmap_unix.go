@@ -0,0 +1,36 @@
+//go:build unix
+
+package index
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// mmapFile maps f into memory read-only. The mapping is rounded up to a
+// page so the capacity of the data is the length mapped.
+func mmapFile(f *os.File) (mmapData, error) {
+	st, err := f.Stat()
+	if err != nil {
+		return mmapData{}, err
+	}
+	size := st.Size()
+	if int64(int(size+4095)) != size+4095 {
+		return mmapData{}, fmt.Errorf("%s: too large for mmap", f.Name())
+	}
+	n := int(size)
+	if n == 0 {
+		return mmapData{f, nil}, nil
+	}
+	data, err := syscall.Mmap(int(f.Fd()), 0, (n+4095)&^4095, syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return mmapData{}, err
+	}
+	return mmapData{f, data[:n]}, nil
+}
+
+// munmap releases data returned by mmapFile.
+func munmap(data []byte) error {
+	return syscall.Munmap(data[:cap(data)])
+}
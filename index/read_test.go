@@ -0,0 +1,71 @@
+package index
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/google/codesearch/index"
+	"github.com/google/codesearch/regexp"
+)
+
+func TestOpenMatchesCodesearch(t *testing.T) {
+	root := t.TempDir()
+	tree := filepath.Join(root, "tree")
+	writeTree(t, tree, map[string]string{
+		"a.go":     "package a\n\nfunc Hello() {}\n",
+		"b.go":     "package b\n\nfunc Goodbye() {}\n",
+		"c/c.txt":  "hello world\n",
+		"c/d/d.md": "nothing to see\n",
+	})
+	indexpath := filepath.Join(root, "index")
+	if _, err := (Idx{}).ReIndex(indexpath, tree); err != nil {
+		t.Fatalf("ReIndex failed: %v", err)
+	}
+
+	want := index.Open(indexpath)
+	got, err := Open(indexpath)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+
+	if g, w := got.Paths(), want.Paths(); !reflect.DeepEqual(g, w) {
+		t.Errorf("Paths got %v want %v", g, w)
+	}
+	queries := []*index.Query{{Op: index.QAll}, {Op: index.QNone}}
+	for _, pat := range []string{"(?i)hello", "func", "package (a|b)", "absent"} {
+		re, err := regexp.Compile(pat)
+		if err != nil {
+			t.Fatalf("can't compile %q: %v", pat, err)
+		}
+		queries = append(queries, index.RegexpQuery(re.Syntax))
+	}
+	for _, q := range queries {
+		g, w := got.PostingQuery(q), want.PostingQuery(q)
+		if !reflect.DeepEqual(g, w) {
+			t.Errorf("PostingQuery(%v) got %v want %v", q, g, w)
+		}
+		for _, id := range g {
+			if g, w := got.Name(id), want.Name(id); g != w {
+				t.Errorf("Name(%d) got %s want %s", id, g, w)
+			}
+		}
+	}
+
+	if err := got.Close(); err != nil {
+		t.Errorf("Close got error %v", err)
+	}
+}
+
+func TestOpenErrors(t *testing.T) {
+	root := t.TempDir()
+	if _, err := Open(filepath.Join(root, "missing")); err == nil {
+		t.Error("Open of a missing index succeeded")
+	}
+
+	bad := filepath.Join(root, "bad")
+	writeTree(t, root, map[string]string{"bad": "not an index\n"})
+	if _, err := Open(bad); err == nil {
+		t.Error("Open of a corrupt index succeeded")
+	}
+}
@@ -0,0 +1,84 @@
+package input
+
+import (
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// testSuffixes are the endings of the base names (without extension) of
+// test files in the languages that I use.
+var testSuffixes = []string{"_test", "_unittest", ".test", ".spec", "Test"}
+
+// splitTestStem splits the base name of a file (without extension)
+// into the name of the file that it tests and its test suffix. The
+// suffix is empty if the file isn't a test.
+func splitTestStem(stem string) (string, string) {
+	for _, ts := range testSuffixes {
+		if s := strings.TrimSuffix(stem, ts); s != stem && s != "" {
+			return s, ts
+		}
+	}
+	return stem, ""
+}
+
+// nearMatchers returns patterns matching files whose base name matches
+// the regexp name. Files sharing more trailing directories with dir are
+// better matches.
+func nearMatchers(dir, name string) []string {
+	m := make([]string, 0)
+	dirs := strings.Split(strings.Trim(dir, "/"), "/")
+	if dirs[0] == "" {
+		dirs = dirs[:0]
+	}
+	for k := len(dirs); k > 0; k-- {
+		m = append(m, "(^|/)"+regexp.QuoteMeta(strings.Join(dirs[len(dirs)-k:], "/"))+"/"+name+"$")
+	}
+	return append(m, "(^|/)"+name+"$")
+}
+
+// contextMatchers returns the filename patterns for the query prefix that
+// names a file relative to the context file ctx:
+//
+//	(empty)  ctx itself before a line, as in :40 or #40
+//	%test    the test of ctx or, if ctx is a test, the file that it tests
+//	%<ext>   the file beside ctx with extension ext, as in %h
+//
+// An empty prefix before a content or symbol search (:/pattern or @sym)
+// still searches the whole project. It reports false if prefix isn't
+// relative to ctx.
+func contextMatchers(prefix, sep, suffix, ctx string) ([]string, bool) {
+	if ctx == "" {
+		return nil, false
+	}
+	ctx = filepath.ToSlash(ctx)
+	dir, file := path.Split(ctx)
+
+	switch {
+	case prefix == "" && (sep == "#" || sep == ":" && !strings.HasPrefix(suffix, "/")):
+		return nearMatchers(dir, regexp.QuoteMeta(file)), true
+	case prefix == "":
+		return nil, false
+	case !strings.HasPrefix(prefix, "%"):
+		return nil, false
+	}
+
+	ext := path.Ext(file)
+	stem, ts := splitTestStem(strings.TrimSuffix(file, ext))
+	switch rel := prefix[1:]; rel {
+	case "":
+		return nearMatchers(dir, regexp.QuoteMeta(file)), true
+	case "test":
+		if ts != "" {
+			return nearMatchers(dir, regexp.QuoteMeta(stem+ext)), true
+		}
+		alts := make([]string, 0, len(testSuffixes))
+		for _, ts := range testSuffixes {
+			alts = append(alts, regexp.QuoteMeta(ts))
+		}
+		return nearMatchers(dir, regexp.QuoteMeta(stem)+"("+strings.Join(alts, "|")+")"+regexp.QuoteMeta(ext)), true
+	default:
+		return nearMatchers(dir, regexp.QuoteMeta(stem+"."+rel)), true
+	}
+}
@@ -0,0 +1,70 @@
+package input
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+func TestParseInContext(t *testing.T) {
+	ctx := "/src/proj/pkg/foo.go"
+	for _, tv := range []struct {
+		query  string
+		ctx    string
+		fn     []string
+		stype  string
+		suffix string
+	}{
+		{":40", ctx, []string{
+			`(^|/)src/proj/pkg/foo\.go$`,
+			`(^|/)proj/pkg/foo\.go$`,
+			`(^|/)pkg/foo\.go$`,
+			`(^|/)foo\.go$`,
+		}, ":", "40"},
+		{"#40", "/foo.go", []string{`(^|/)foo\.go$`}, ":", "40"},
+		{"%:/Bar", "/foo.go", []string{`(^|/)foo\.go$`}, "/", ".*Bar.*"},
+		{"%h", "/a/foo_test.cc", []string{`(^|/)a/foo\.h$`, `(^|/)foo\.h$`}, ":", ""},
+		{"%test", "/a/foo_test.go", []string{`(^|/)a/foo\.go$`, `(^|/)foo\.go$`}, ":", ""},
+		{"%test:12", "/a/foo.go", []string{
+			`(^|/)a/foo(_test|_unittest|\.test|\.spec|Test)\.go$`,
+			`(^|/)foo(_test|_unittest|\.test|\.spec|Test)\.go$`,
+		}, ":", "12"},
+		// Not relative to the context.
+		{"a:10", ctx, []string{"a[^/]*$", "a", "^a", "a", ".*a.*"}, ":", "10"},
+		{":40", "", []string{"[^/]*$", "", "^", "", ".*.*"}, ":", "40"},
+		{":/Bar", ctx, []string{"[^/]*$", "", "^", "", ".*.*"}, "/", ".*Bar.*"},
+	} {
+		fn, stype, suffix := ParseInContext(tv.query, tv.ctx)
+		if !reflect.DeepEqual(fn, tv.fn) || stype != tv.stype || suffix != tv.suffix {
+			t.Errorf("ParseInContext(%q, %q) got %#v, %q, %q expected %#v, %q, %q",
+				tv.query, tv.ctx, fn, stype, suffix, tv.fn, tv.stype, tv.suffix)
+		}
+	}
+}
+
+func TestContextMatchersMatch(t *testing.T) {
+	for _, tv := range []struct {
+		query string
+		ctx   string
+		match []string
+		miss  []string
+	}{
+		{"%test", "/src/foo.go", []string{"pkg/foo_test.go", "foo_test.go"}, []string{"foo.go", "barfoo_test.go", "foo_test.cc"}},
+		{"%test", "/src/foo.test.js", []string{"src/foo.js"}, []string{"foo.test.js"}},
+		{"%test", "/src/FooTest.java", []string{"src/Foo.java"}, []string{"src/FooTest.java"}},
+		{"%h", "/src/foo.cc", []string{"include/foo.h"}, []string{"foo.hh", "foo.cc"}},
+	} {
+		fn, _, _ := ParseInContext(tv.query, tv.ctx)
+		re := regexp.MustCompile(fn[len(fn)-1])
+		for _, m := range tv.match {
+			if !re.MatchString(m) {
+				t.Errorf("%q in %q: %q should match %q", tv.query, tv.ctx, re, m)
+			}
+		}
+		for _, m := range tv.miss {
+			if re.MatchString(m) {
+				t.Errorf("%q in %q: %q shouldn't match %q", tv.query, tv.ctx, re, m)
+			}
+		}
+	}
+}
@@ -6,7 +6,15 @@
 //
 // Leap's search syntax: <path>[:number] | [<path>][:/<search>]. The
 // path will filter the list of files to those that match (fuzzily) the
-// provided path. The search string can be any valid regexp.
+// provided path. The search string can be any valid regexp. A leading
+// ! restricts the results to files changed in the git working tree and
+// a leading *: searches every configured project. Given a context file,
+// such as the file being edited, an empty path before a line means the
+// context file (e.g. :40), %test means its test (or the file it tests) and %<ext>
+// means the file beside it with extension ext (e.g. %h). 'name finds the
+// project's bookmarks starting with name. A path ending in / before a
+// content or symbol search, as in pkg/server/:/Token, limits the search to
+// the directory best matching the path.
 //
 // Leap's output is intended to be used in an Alfred app workflow.
 // Amongst other content, the arg value for each entry ends being
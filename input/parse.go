@@ -66,23 +66,84 @@ func symbolExp(s string) string {
 
 // Parse generates query-language specific regexps and a query type.
 func Parse(s string) ([]string, string, string) {
+	return ParseInContext(s, "")
+}
+
+// ParseInContext is Parse for queries that can name files relative to
+// the context file ctx (such as the file being edited): :40 is line 40
+// of ctx, %test is its test and %h is its header. :/pattern and @sym
+// still search the whole project. ctx can be empty.
+func ParseInContext(s, ctx string) ([]string, string, string) {
 	prefix, sep, suffix := chunkInput(s)
+	matchers, ok := contextMatchers(prefix, sep, suffix, ctx)
+	if !ok {
+		matchers = fuzzyMatchers(prefix)
+	}
+
 	switch sep {
 	case "@":
-		return fuzzyMatchers(prefix), "/", symbolExp(suffix)
+		return matchers, "/", symbolExp(suffix)
 	case "#":
-		return fuzzyMatchers(prefix), ":", numCheck(suffix)
+		return matchers, ":", numCheck(suffix)
 	case ":":
-		if suffix[0] == '/' {
-			return fuzzyMatchers(prefix), "/", inLineExp(suffix[1:])
+		if len(suffix) > 0 && suffix[0] == '/' {
+			return matchers, "/", inLineExp(suffix[1:])
 		}
-		return fuzzyMatchers(prefix), ":", numCheck(suffix)
+		return matchers, ":", numCheck(suffix)
 	case "":
-		return fuzzyMatchers(prefix), ":", ""
+		return matchers, ":", ""
 	}
 	return []string{""}, "", ""
 }
 
+// Scope splits a directory-scoped query such as pkg/server/:/Token into
+// the filename patterns choosing the directory to search in and the query
+// to run there (:/Token). Only content and symbol queries can be scoped.
+// scope is nil if s isn't scoped.
+func Scope(s string) ([]string, string) {
+	prefix, sep, suffix := chunkInput(s)
+	if !strings.HasSuffix(prefix, "/") || !(sep == "@" || sep == ":" && strings.HasPrefix(suffix, "/")) {
+		return nil, s
+	}
+	return fuzzyMatchers(prefix), sep + suffix
+}
+
+// ParseScoped is ParseInContext for queries that can be scoped to a
+// directory as with Scope.
+func ParseScoped(s, ctx string) (scope, fn []string, stype, suffix string) {
+	scope, s = Scope(s)
+	fn, stype, suffix = ParseInContext(s, ctx)
+	return scope, fn, stype, suffix
+}
+
+// Qualifiers are short prefixes to a query that change how the query
+// is run rather than what it matches.
+type Qualifiers struct {
+	// Changed restricts results to files changed in the git working tree.
+	Changed bool
+	// All searches every project instead of only the current one.
+	All bool
+}
+
+// Qualify strips the qualifiers from the start of s, returning them and
+// the remaining query.
+func Qualify(s string) (Qualifiers, string) {
+	var q Qualifiers
+	for len(s) > 0 {
+		switch {
+		case s[0] == '!':
+			q.Changed = true
+		case strings.HasPrefix(s, "*:"):
+			q.All = true
+			s = s[1:]
+		default:
+			return q, s
+		}
+		s = s[1:]
+	}
+	return q, s
+}
+
 func numCheck(s string) string {
 	_, err := strconv.Atoi(s)
 	if err != nil {
@@ -125,7 +125,6 @@ func TestNumCheck(t *testing.T) {
 	if a, ea := numCheck("23"), "23"; a != ea {
 		t.Errorf("got %v exepcted %v", a, ea)
 	}
-
 }
 
 func TestSymbolExp(t *testing.T) {
@@ -205,3 +204,67 @@ func TestFuzzyMatchers(t *testing.T) {
 		t.Errorf("got %v, exepcted %v", litter.Sdump(a), litter.Sdump(ea))
 	}
 }
+
+func TestQualify(t *testing.T) {
+	tt := []struct {
+		in     string
+		q      Qualifiers
+		remain string
+	}{
+		{"", Qualifiers{}, ""},
+		{"ab:/c", Qualifiers{}, "ab:/c"},
+		{"!ab", Qualifiers{Changed: true}, "ab"},
+		{"!!:/c", Qualifiers{Changed: true}, ":/c"},
+		{"a!b", Qualifiers{}, "a!b"},
+		{"*:ab", Qualifiers{All: true}, "ab"},
+		{"*:!ab:/c", Qualifiers{Changed: true, All: true}, "ab:/c"},
+		{"!*:ab", Qualifiers{Changed: true, All: true}, "ab"},
+		{"*ab", Qualifiers{}, "*ab"},
+	}
+
+	for _, tv := range tt {
+		q, remain := Qualify(tv.in)
+		if q != tv.q || remain != tv.remain {
+			t.Errorf("Qualify(%q) got %#v, %q exepcted %#v, %q", tv.in, q, remain, tv.q, tv.remain)
+		}
+	}
+}
+
+func TestScope(t *testing.T) {
+	for _, tv := range []struct {
+		in    string
+		scope []string
+		rest  string
+	}{
+		{"pkg/server/:/Token", fuzzyMatchers("pkg/server/"), ":/Token"},
+		{"pkg/@Tok", fuzzyMatchers("pkg/"), "@Tok"},
+		{"pkg/server/:12", nil, "pkg/server/:12"},
+		{"pkg/server:/Token", nil, "pkg/server:/Token"},
+		{"pkg/server/", nil, "pkg/server/"},
+	} {
+		scope, rest := Scope(tv.in)
+		if !reflect.DeepEqual(scope, tv.scope) || rest != tv.rest {
+			t.Errorf("Scope(%q) got %v, %q expected %v, %q", tv.in, scope, rest, tv.scope, tv.rest)
+		}
+	}
+}
+
+func TestParseScoped(t *testing.T) {
+	ctx := "/home/src/leap/base/config.go"
+	for _, tv := range []struct {
+		in    string
+		scope []string
+		rest  string
+	}{
+		// The context doesn't limit a scoped query to the context file.
+		{"pkg/server/:/Token", fuzzyMatchers("pkg/server/"), ":/Token"},
+		{"pkg/@Tok", fuzzyMatchers("pkg/"), "@Tok"},
+	} {
+		scope, fn, stype, suffix := ParseScoped(tv.in, ctx)
+		wfn, wstype, wsuffix := Parse(tv.rest)
+		if !reflect.DeepEqual(scope, tv.scope) || !reflect.DeepEqual(fn, wfn) || stype != wstype || suffix != wsuffix {
+			t.Errorf("ParseScoped(%q) got %v, %q, %q, %q expected %v, %q, %q, %q",
+				tv.in, scope, fn, stype, suffix, tv.scope, wfn, wstype, wsuffix)
+		}
+	}
+}
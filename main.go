@@ -4,37 +4,60 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"log/slog"
 	"os"
+	"os/exec"
+	"strings"
 	"time"
 
 	"github.com/rjkroege/leap/base"
 	"github.com/rjkroege/leap/client"
 	"github.com/rjkroege/leap/index"
 	"github.com/rjkroege/leap/input"
+	"github.com/rjkroege/leap/opener"
 	"github.com/rjkroege/leap/output"
+	"github.com/rjkroege/leap/preview"
 	"github.com/rjkroege/leap/search"
 	"github.com/rjkroege/leap/server"
 	// Uncomment to turn on profiling.
 	// "github.com/pkg/profile"
-	"github.com/rjkroege/gozen"
 )
 
-// TODO(rjk): It is conceivable that I will want to support having a re-writing
-// path configuration: client can re-write paths for where the file is to be found
-// in the client. I currently don't have this issue. So I'm not going to deal.
 var (
 	testlog = flag.Bool("testlog", false,
 		"Log in the conventional way for running in a terminal. Also changes where to find the configuration file.")
 	runServer = flag.Bool("server", false, "Run as a server. If a server is already running, does nothing.")
 	stop      = flag.Bool("stop", false, "Connect to the configured server and stop it.")
+	status    = flag.Bool("status", false, "Connect to the configured server and print its status.")
 
 	indexcmd    = flag.Bool("index", false, "Connect to the configured server and ask it to re-index the configured path.")
 	decodePlumb = flag.Bool("dp", false,
-		"Decode the single provided path and convert it back into a valid plumb address")
+		"Decode the single provided path and open it with the configured opener (Acme by default)")
 
 	printcsindex = flag.Bool("cspath", false, "Print the path needed for CSEARCHINDEX")
+	allprojects  = flag.Bool("all", false, "Search every configured project. Same as starting the query with *:")
+	sweep        = flag.Bool("sweep", false, "Evict the least recently used previews and the oldest cached remote files if it's time to do so.")
+	exportaddr   = flag.String("export", "", "With -server, export the indexed trees over 9P on this address. e.g. :5640 on the loopback interface or 0.0.0.0:5640 on every interface. There's no authentication.")
+	exportwrite  = flag.Bool("exportwrite", false, "With -export, let clients change the exported files.")
+	context      = flag.String("context", "", "Resolve queries such as :40, %test or %h relative to this file. Defaults to $LEAP_CONTEXT or the Acme window in $winid.")
+	checkconfig  = flag.Bool("checkconfig", false, "Report problems with the configuration file without changing it.")
+	showhistory  = flag.Bool("history", false, "List the recent queries of the project if it keeps a history.")
+	mount        = flag.Bool("mount", false, "Mount the configured server's export of the project at the project's mount point.")
+	projects     = flag.Bool("projects", false, "List the projects starting with the query as results. Pass the chosen one to leap project use to switch to it.")
 )
 
+// loadConfiguration reads the configuration and logs at its level.
+func loadConfiguration() (*base.Configuration, error) {
+	config, err := base.LoadConfiguration(*testlog)
+	if err != nil {
+		return nil, err
+	}
+	if err := base.SetLogLevel(config.Loglevel); err != nil {
+		slog.Warn("using the default log level", "err", err)
+	}
+	return config, nil
+}
+
 func main() {
 	// Uncomment to turn on profiling.
 	// defer profile.Start().Stop()
@@ -42,6 +65,10 @@ func main() {
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Usage of %s:\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "	%s <flags listed below> <search string>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "	%s <flags listed below> <command> <verb> <args>\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Commands:\n")
+		base.CommandUsage(os.Stderr)
+		fmt.Fprintf(os.Stderr, "Flags:\n")
 		flag.PrintDefaults()
 	}
 	flag.Parse()
@@ -50,40 +77,62 @@ func main() {
 			log.Fatalf("can't setup right logging: %v", err)
 		}
 		defer base.RollLogs("leap")
+	} else {
+		base.LogTo(os.Stderr)
 	}
 
 	switch {
 	case *decodePlumb:
 		log.Println("running decodePlumb")
-		os.RemoveAll(base.SubPrefix)
 		if flag.NArg() != 1 {
 			flag.Usage()
 			os.Exit(0)
 		}
 		path := input.EncodedToPlumb(flag.Arg(0))
 		log.Println("output", path)
-		// fmt.Println(path)
-		if err := gozen.Editinacme(path); err != nil {
-			log.Fatalf("can't tell Edwood/Acme to open %s: %v", path, err)
+
+		spec := ""
+		if config, err := loadConfiguration(); err == nil {
+			spec = config.Opener
+			if config.History {
+				recordChoice(config, path)
+			}
+		} else {
+			log.Println("couldn't read configuration, opening in Acme: ", err)
+		}
+		o, err := opener.New(spec)
+		if err != nil {
+			log.Fatalf("can't make opener: %v", err)
+		}
+		if err := o.Open(opener.ParseLocation(path)); err != nil {
+			log.Fatalf("can't open %s: %v", path, err)
+		}
+		os.Exit(0)
+	case *sweep:
+		if _, err := preview.Default().SweepIfDue(preview.DefaultSweepInterval); err != nil {
+			log.Fatalf("can't sweep previews: %v", err)
+		}
+		if _, err := client.FileCacheSweeper().SweepIfDue(preview.DefaultSweepInterval); err != nil {
+			log.Fatalf("can't sweep cached files: %v", err)
 		}
 		os.Exit(0)
 	case *runServer:
 		fmt.Fprintln(os.Stderr, "go run as server")
-		config, err := base.GetConfiguration(base.Filepath(*testlog))
+		config, err := loadConfiguration()
 		if err != nil {
 			log.Fatal("couldn't read configuration: ", err)
 		}
-		server.BeginServing(config)
+		server.BeginServingWithExport(config, *exportaddr, *exportwrite)
 		os.Exit(0)
 	case *printcsindex:
-		config, err := base.GetConfiguration(base.Filepath(*testlog))
+		config, err := loadConfiguration()
 		if err != nil {
 			log.Fatal("couldn't read configuration: ", err)
 		}
 		fmt.Printf(config.Indexpath)
 		os.Exit(0)
 	case *stop:
-		config, err := base.GetConfiguration(base.Filepath(*testlog))
+		config, err := loadConfiguration()
 		if err != nil {
 			log.Fatal("couldn't read configuration: ", err)
 			return
@@ -92,9 +141,63 @@ func main() {
 			log.Println("shutdown generated output: ", err)
 		}
 		os.Exit(0)
+	case *status:
+		config, err := loadConfiguration()
+		if err != nil {
+			log.Fatal("couldn't read configuration: ", err)
+		}
+		st, err := client.Status(config)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		client.PrintStatus(os.Stdout, st)
+		os.Exit(0)
+	case *checkconfig:
+		fp := base.Filepath(*testlog)
+		problems, err := base.CheckConfiguration(fp)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		for _, p := range problems {
+			fmt.Println(p)
+		}
+		if len(problems) > 0 {
+			os.Exit(1)
+		}
+		fmt.Printf("%s is fine\n", fp)
+		os.Exit(0)
+	case *showhistory:
+		config, err := loadConfiguration()
+		if err != nil {
+			log.Fatal("couldn't read configuration: ", err)
+		}
+		output.WriteOut(os.Stdout, recentQueries(config))
+		os.Exit(0)
+	case *projects:
+		config, err := loadConfiguration()
+		if err != nil {
+			log.Fatal("couldn't read configuration: ", err)
+		}
+		newconfig := config.GetNewConfiguration()
+		if newconfig == nil {
+			log.Fatal("listing projects requires upgraded config")
+		}
+		output.WriteOut(os.Stdout, search.Projects(newconfig, flag.Arg(0), time.Now()))
+		os.Exit(0)
+	case *mount:
+		config, err := loadConfiguration()
+		if err != nil {
+			log.Fatal("couldn't read configuration: ", err)
+		}
+		if err := client.Mount(config, client.NinePFuse{}); err != nil {
+			log.Fatalf("can't mount project: %v", err)
+		}
+		os.Exit(0)
 	case *indexcmd:
 		// TODO(rjk): Pull this block out into a helper function.
-		config, err := base.GetConfiguration(base.Filepath(*testlog))
+		config, err := loadConfiguration()
 		if err != nil {
 			log.Fatal("couldn't read configuration: ", err)
 			return
@@ -121,42 +224,52 @@ func main() {
 		os.Exit(0)
 	}
 
-	// May exit.
-	base.UpdateConfigIfNecessary(flag.Args(), *testlog)
-	os.RemoveAll(base.SubPrefix)
+	if base.IsCommand(flag.Args()) {
+		err := base.RunCommand(base.Filepath(*testlog), flag.Args(), os.Stdout)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		os.Exit(base.ExitCode(err))
+	}
 
-	config, err := base.GetConfiguration(base.Filepath(*testlog))
+	if ok, err := base.UpdateConfigIfNecessary(flag.Args(), *testlog, os.Stdout); ok {
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			if base.ExitCode(err) == 2 {
+				flag.Usage()
+			}
+		}
+		os.Exit(base.ExitCode(err))
+	}
+
+	config, err := loadConfiguration()
 	if err != nil {
 		log.Println("couldn't read configuration: ", err)
 		return
 	}
 
-	fn, stype, suffix := input.Parse(flag.Arg(0))
+	trace := base.NewTraceID()
+	stime := time.Now()
+	qualifiers, query := input.Qualify(flag.Arg(0))
 
 	var entries []output.Entry
-
-	if config.Connect && stype != ":" {
-		stime := time.Now()
-		search := search.NewTrigramSearch(config.Indexpath, config.Prefixes)
-		log.Printf("running remote query after NewTrigramSearch %v\n", time.Since(stime))
-		// TODO(rjk): Dialing the remote can be expensive because ssh. I should overlap
-		// the connect with the search of the local index.
-		inremotes, err := client.NewRemoteInternalSearcher(config)
-		if err != nil {
-			log.Fatalln("problem connecting to server: ", err)
-			return
-		}
-		log.Printf("running remote query after NewRemoteInternalSearcher %v\n", time.Since(stime))
-		entries, err = search.Query(fn, stype, []string{suffix}, inremotes)
-		log.Printf("query remote %v, %v, %v tool %v\n", fn, stype, suffix, time.Since(stime))
+	if name, ok := strings.CutPrefix(query, "'"); ok {
+		entries = search.Bookmarks(config.Bookmarks, name)
 	} else {
-		stime := time.Now()
-		search := search.NewTrigramSearch(config.Indexpath, config.Prefixes)
-		// TODO(rjk): error check
-		entries, _ = search.Query(fn, stype, []string{suffix}, search)
-		log.Printf("query local %v, %v, %v tool %v\n", fn, stype, suffix, time.Since(stime))
+		entries = querySources(config, qualifiers, query, trace)
 	}
-	stime := time.Now()
+
 	output.WriteOut(os.Stdout, entries)
-	log.Printf("after query, WriteOut %v\n", time.Since(stime))
+	slog.Info("query", base.TraceKey, trace, "query", flag.Arg(0), "results", len(entries), "elapsed", time.Since(stime))
+
+	if config.History && flag.Arg(0) != "" {
+		recordQuery(config, flag.Arg(0))
+	}
+
+	// Bound the previews and cached files without delaying the results.
+	if preview.Default().Due(preview.DefaultSweepInterval) || client.FileCacheSweeper().Due(preview.DefaultSweepInterval) {
+		if err := exec.Command(os.Args[0], "-sweep").Start(); err != nil {
+			log.Println("can't start sweeping previews: ", err)
+		}
+	}
 }
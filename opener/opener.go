@@ -0,0 +1,218 @@
+// Package opener opens the files selected from leap's results in an
+// editor. Which editor is configured per project.
+package opener
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"9fans.net/go/plan9"
+	"9fans.net/go/plumb"
+	"github.com/rjkroege/gozen"
+)
+
+// Location is a place in a file to open. Line and Col are 1-based and 0
+// when not known.
+type Location struct {
+	File string
+	Line int
+	Col  int
+}
+
+// ParseLocation converts a plumb string <path>[:line[:col]] into a
+// Location.
+func ParseLocation(s string) Location {
+	loc := Location{File: s}
+	for _, p := range []*int{&loc.Col, &loc.Line} {
+		i := strings.LastIndex(loc.File, ":")
+		if i < 0 {
+			break
+		}
+		n, err := strconv.Atoi(loc.File[i+1:])
+		if err != nil || n < 1 {
+			break
+		}
+		*p = n
+		loc.File = loc.File[:i]
+	}
+	if loc.Line == 0 {
+		// Only a single number: it's a line.
+		loc.Line, loc.Col = loc.Col, 0
+	}
+	return loc
+}
+
+// String returns the plumb string for loc.
+func (loc Location) String() string {
+	switch {
+	case loc.Line > 0 && loc.Col > 0:
+		return fmt.Sprintf("%s:%d:%d", loc.File, loc.Line, loc.Col)
+	case loc.Line > 0:
+		return fmt.Sprintf("%s:%d", loc.File, loc.Line)
+	}
+	return loc.File
+}
+
+// Opener opens a Location in an editor.
+type Opener interface {
+	Open(loc Location) error
+}
+
+// runner lets me mock out running commands.
+type runner interface {
+	Run(name string, args ...string) error
+}
+
+type execRunner struct{}
+
+func (_ execRunner) Run(name string, args ...string) error {
+	cmd := exec.Command(name, args...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("can't run %s %v: %v", name, args, err)
+	}
+	return nil
+}
+
+// Acme opens files in Acme or Edwood.
+type Acme struct {
+	// edit opens a plumb string in the editor.
+	edit func(string) error
+}
+
+func NewAcme() *Acme {
+	return &Acme{
+		edit: gozen.Editinacme,
+	}
+}
+
+func (a *Acme) Open(loc Location) error {
+	return a.edit(loc.String())
+}
+
+// Plumber sends the file to the Plan 9 plumber's edit port.
+type Plumber struct {
+	// send opens the plumber's send file.
+	send func() (io.WriteCloser, error)
+}
+
+func NewPlumber() *Plumber {
+	return &Plumber{
+		send: func() (io.WriteCloser, error) {
+			return plumb.Open("send", plan9.OWRITE)
+		},
+	}
+}
+
+func (p *Plumber) Open(loc Location) error {
+	w, err := p.send()
+	if err != nil {
+		return fmt.Errorf("can't open the plumber: %v", err)
+	}
+	defer w.Close()
+
+	msg := &plumb.Message{
+		Src:  "leap",
+		Dst:  "edit",
+		Dir:  filepath.Dir(loc.File),
+		Type: "text",
+		Data: []byte(loc.String()),
+	}
+	if err := msg.Send(w); err != nil {
+		return fmt.Errorf("can't plumb %s: %v", loc, err)
+	}
+	return nil
+}
+
+// Editor runs a terminal editor as "editor +line file". The editor is
+// $EDITOR unless Command is set.
+type Editor struct {
+	Command string
+	run     runner
+}
+
+func (e *Editor) Open(loc Location) error {
+	cmd := e.Command
+	if cmd == "" {
+		cmd = os.Getenv("EDITOR")
+	}
+	if cmd == "" {
+		return fmt.Errorf("no editor: set $EDITOR")
+	}
+	args := strings.Fields(cmd)
+	if loc.Line > 0 {
+		args = append(args, "+"+strconv.Itoa(loc.Line))
+	}
+	args = append(args, loc.File)
+	return e.run.Run(args[0], args[1:]...)
+}
+
+// Code runs VS Code (or an editor with the same command line) as
+// "code -g file:line:col".
+type Code struct {
+	Command string
+	run     runner
+}
+
+func (c *Code) Open(loc Location) error {
+	cmd := c.Command
+	if cmd == "" {
+		cmd = "code"
+	}
+	return c.run.Run(cmd, "-g", loc.String())
+}
+
+// Template runs the command described by a template. The template is
+// split into words and then {file}, {line} and {col} are replaced in each
+// word so that file names containing spaces remain a single argument.
+type Template struct {
+	Template string
+	run      runner
+}
+
+func (t *Template) Open(loc Location) error {
+	words := strings.Fields(t.Template)
+	if len(words) == 0 {
+		return fmt.Errorf("empty opener template")
+	}
+	r := strings.NewReplacer(
+		"{file}", loc.File,
+		"{line}", strconv.Itoa(max(loc.Line, 1)),
+		"{col}", strconv.Itoa(max(loc.Col, 1)),
+	)
+	for i, w := range words {
+		words[i] = r.Replace(w)
+	}
+	return t.run.Run(words[0], words[1:]...)
+}
+
+// New returns the Opener named by spec: one of "acme" (the default when
+// spec is empty), "plumb", "editor" or "code". Any other spec is a
+// command Template such as "subl {file}:{line}:{col}".
+func New(spec string) (Opener, error) {
+	return newWithRunner(spec, execRunner{})
+}
+
+func newWithRunner(spec string, run runner) (Opener, error) {
+	switch spec {
+	case "", "acme":
+		return NewAcme(), nil
+	case "plumb":
+		return NewPlumber(), nil
+	case "editor":
+		return &Editor{run: run}, nil
+	case "code":
+		return &Code{run: run}, nil
+	}
+	if !strings.Contains(spec, "{file}") {
+		return nil, fmt.Errorf("opener %q is not acme, plumb, editor, code or a template containing {file}", spec)
+	}
+	return &Template{Template: spec, run: run}, nil
+}
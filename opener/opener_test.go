@@ -0,0 +1,153 @@
+package opener
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+
+	"9fans.net/go/plumb"
+)
+
+type fakeRunner struct {
+	cmds [][]string
+}
+
+func (f *fakeRunner) Run(name string, args ...string) error {
+	f.cmds = append(f.cmds, append([]string{name}, args...))
+	return nil
+}
+
+type fakeSend struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (f *fakeSend) Close() error {
+	f.closed = true
+	return nil
+}
+
+func TestParseLocation(t *testing.T) {
+	for _, tv := range []struct {
+		in   string
+		want Location
+	}{
+		{"/a/b.go", Location{"/a/b.go", 0, 0}},
+		{"/a/b.go:12", Location{"/a/b.go", 12, 0}},
+		{"/a/b.go:12:3", Location{"/a/b.go", 12, 3}},
+		{"/a/b:c.go", Location{"/a/b:c.go", 0, 0}},
+		// Directories open as directory windows.
+		{"/a/b/", Location{"/a/b/", 0, 0}},
+	} {
+		got := ParseLocation(tv.in)
+		if got != tv.want {
+			t.Errorf("ParseLocation(%q) got %#v want %#v", tv.in, got, tv.want)
+		}
+		if got.String() != tv.in {
+			t.Errorf("%#v.String() got %q want %q", got, got.String(), tv.in)
+		}
+	}
+}
+
+func TestPlumber(t *testing.T) {
+	send := &fakeSend{}
+	p := &Plumber{send: func() (io.WriteCloser, error) { return send, nil }}
+
+	if err := p.Open(Location{"/a/b.go", 12, 0}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !send.closed {
+		t.Errorf("didn't close the plumber's send file")
+	}
+
+	var msg plumb.Message
+	if err := msg.Recv(bufio.NewReader(&send.Buffer)); err != nil {
+		t.Fatalf("can't read sent message: %v", err)
+	}
+	if got, want := msg, (plumb.Message{Src: "leap", Dst: "edit", Dir: "/a", Type: "text", Data: []byte("/a/b.go:12")}); !reflect.DeepEqual(got, want) {
+		t.Errorf("plumbed %#v want %#v", got, want)
+	}
+}
+
+func TestAcme(t *testing.T) {
+	var edited []string
+	a := &Acme{edit: func(s string) error {
+		edited = append(edited, s)
+		return nil
+	}}
+
+	in := []string{"/a/b.go", "/a/b.go:12", "/a/my file.go:12:3", "/a/b/"}
+	for _, s := range in {
+		if err := a.Open(ParseLocation(s)); err != nil {
+			t.Errorf("Open(%q) unexpected error: %v", s, err)
+		}
+	}
+	if !reflect.DeepEqual(edited, in) {
+		t.Errorf("edited %q want %q", edited, in)
+	}
+
+	a.edit = func(string) error { return errors.New("no acme") }
+	if err := a.Open(ParseLocation("/a/b.go")); err == nil {
+		t.Errorf("expected the edit error")
+	}
+}
+
+func TestCommandOpeners(t *testing.T) {
+	t.Setenv("EDITOR", "vim -p")
+	loc := Location{"/a/my file.go", 12, 3}
+
+	for _, tv := range []struct {
+		spec string
+		want []string
+	}{
+		{"editor", []string{"vim", "-p", "+12", "/a/my file.go"}},
+		{"code", []string{"code", "-g", "/a/my file.go:12:3"}},
+		{"subl {file}:{line}:{col}", []string{"subl", "/a/my file.go:12:3"}},
+		{"emacsclient -n +{line}:{col} {file}", []string{"emacsclient", "-n", "+12:3", "/a/my file.go"}},
+	} {
+		run := &fakeRunner{}
+		o, err := newWithRunner(tv.spec, run)
+		if err != nil {
+			t.Fatalf("newWithRunner(%q) unexpected error: %v", tv.spec, err)
+		}
+		if err := o.Open(loc); err != nil {
+			t.Errorf("%q Open unexpected error: %v", tv.spec, err)
+		}
+		if got, want := run.cmds, [][]string{tv.want}; !reflect.DeepEqual(got, want) {
+			t.Errorf("%q ran %q want %q", tv.spec, got, want)
+		}
+	}
+}
+
+func TestEditorWithoutLine(t *testing.T) {
+	t.Setenv("EDITOR", "")
+	run := &fakeRunner{}
+	e := &Editor{run: run}
+	if err := e.Open(Location{File: "/a/b.go"}); err == nil {
+		t.Errorf("expected an error without $EDITOR")
+	}
+
+	e.Command = "nano"
+	if err := e.Open(Location{File: "/a/b.go"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got, want := run.cmds, [][]string{{"nano", "/a/b.go"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ran %q want %q", got, want)
+	}
+}
+
+func TestNew(t *testing.T) {
+	for _, spec := range []string{"", "acme"} {
+		if o, err := New(spec); err != nil {
+			t.Errorf("New(%q) unexpected error: %v", spec, err)
+		} else if _, ok := o.(*Acme); !ok {
+			t.Errorf("New(%q) got %T want *Acme", spec, o)
+		}
+	}
+	if _, err := New("vi"); err == nil {
+		t.Errorf("expected an error for a template without {file}")
+	}
+}
@@ -0,0 +1,29 @@
+package output
+
+// Tag prefixes the SubTitle of each of entries with the name of the
+// project that produced it.
+func Tag(entries []Entry, project string) []Entry {
+	for i := range entries {
+		entries[i].SubTitle = "[" + project + "] " + entries[i].SubTitle
+	}
+	return entries
+}
+
+// Interleave merges several ranked lists of entries by taking the best
+// remaining entry from each list in turn. It returns at most limit entries.
+func Interleave(lists [][]Entry, limit int) []Entry {
+	merged := make([]Entry, 0, limit)
+	for rank := 0; len(merged) < limit; rank++ {
+		added := false
+		for _, l := range lists {
+			if rank < len(l) && len(merged) < limit {
+				merged = append(merged, l[rank])
+				added = true
+			}
+		}
+		if !added {
+			break
+		}
+	}
+	return merged
+}
@@ -0,0 +1,39 @@
+package output
+
+import (
+	"reflect"
+	"testing"
+)
+
+func titles(entries []Entry) []string {
+	ts := make([]string, 0, len(entries))
+	for _, e := range entries {
+		ts = append(ts, e.Title)
+	}
+	return ts
+}
+
+func TestTag(t *testing.T) {
+	entries := Tag([]Entry{{Title: "a", SubTitle: "src/a"}}, "proj")
+	if got, want := entries[0].SubTitle, "[proj] src/a"; got != want {
+		t.Errorf("got %q exepcted %q", got, want)
+	}
+}
+
+func TestInterleave(t *testing.T) {
+	lists := [][]Entry{
+		{{Title: "a1"}, {Title: "a2"}, {Title: "a3"}},
+		nil,
+		{{Title: "b1"}},
+	}
+
+	if got, want := titles(Interleave(lists, 10)), []string{"a1", "b1", "a2", "a3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v exepcted %v", got, want)
+	}
+	if got, want := titles(Interleave(lists, 3)), []string{"a1", "b1", "a2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v exepcted %v", got, want)
+	}
+	if got := Interleave(nil, 3); len(got) != 0 {
+		t.Errorf("got %v exepcted nothing", got)
+	}
+}
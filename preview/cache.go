@@ -0,0 +1,254 @@
+// Package preview keeps the copies of matched files that Alfred's
+// quicklook and icons need at the encoded paths under base.Prefix.
+//
+// Each distinct file content is stored once as a blob named by its
+// hash. The encoded paths are hard links to the blobs (or copies when
+// linking isn't possible) so a file matched at many lines costs its size
+// once. The cache persists between invocations and is bounded in size by
+// Sweep, which evicts the least recently used previews.
+package preview
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rjkroege/leap/base"
+)
+
+// DefaultLimit is the default bound on the total size of the previews.
+const DefaultLimit = 256 * 1024 * 1024
+
+// DefaultSweepInterval is how often Default caches are swept.
+const DefaultSweepInterval = time.Hour
+
+const (
+	blobdir   = ".blobs"
+	stampfile = ".swept"
+)
+
+type Cache struct {
+	root  string
+	limit int64
+
+	// The hashes of the files already Put. A file matched at several
+	// lines is only read once.
+	lock sync.Mutex
+	sums map[string]string
+}
+
+// New makes a Cache of the previews under root bounded to limit bytes.
+func New(root string, limit int64) *Cache {
+	return &Cache{
+		root:  root,
+		limit: limit,
+		sums:  make(map[string]string),
+	}
+}
+
+// Default returns the Cache of the previews under base.SubPrefix.
+func Default() *Cache {
+	return New(base.SubPrefix, DefaultLimit)
+}
+
+// hashFile returns the hex encoded hash of the contents of the file at
+// path.
+func hashFile(path string) (string, error) {
+	fd, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer fd.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, fd); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// copyFile copies src to dest via a temporary file so that dest is never
+// incomplete. Where the filesystem supports it, io.Copy between files
+// uses copy_file_range and shares (reflinks) the data.
+func copyFile(src, dest string) error {
+	sfd, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer sfd.Close()
+
+	tmp := dest + "-temporary"
+	dfd, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dfd, sfd); err != nil {
+		dfd.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := dfd.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, dest)
+}
+
+// Put makes the file at dest a preview of the file at src. dest should
+// be inside of the cache's root.
+func (c *Cache) Put(src, dest string) error {
+	c.lock.Lock()
+	sum, ok := c.sums[src]
+	c.lock.Unlock()
+	if !ok {
+		var err error
+		if sum, err = hashFile(src); err != nil {
+			return fmt.Errorf("can't hash %s: %v", src, err)
+		}
+		c.lock.Lock()
+		c.sums[src] = sum
+		c.lock.Unlock()
+	}
+
+	blobs := filepath.Join(c.root, blobdir)
+	if err := os.MkdirAll(blobs, 0700); err != nil {
+		return fmt.Errorf("can't make %s: %v", blobs, err)
+	}
+	blob := filepath.Join(blobs, sum)
+
+	if _, err := os.Stat(blob); err == nil {
+		// Mark the blob (and so all of its links) as recently used.
+		now := time.Now()
+		os.Chtimes(blob, now, now)
+	} else if err := copyFile(src, blob); err != nil {
+		return fmt.Errorf("can't store %s: %v", src, err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dest), 0700); err != nil {
+		return fmt.Errorf("can't make directory for %s: %v", dest, err)
+	}
+	os.Remove(dest)
+	if err := os.Link(blob, dest); err == nil {
+		return nil
+	}
+	if err := copyFile(blob, dest); err != nil {
+		return fmt.Errorf("can't copy preview of %s to %s: %v", src, dest, err)
+	}
+	return nil
+}
+
+// group is the paths in the cache that are the same file.
+type group struct {
+	paths []string
+	info  fs.FileInfo
+}
+
+// Sweep evicts the least recently used previews until the cache is no
+// bigger than its limit.
+func (c *Cache) Sweep() error {
+	// Links of the same file share their size and modification time so
+	// only need to compare files within such a bucket.
+	type bucket struct {
+		size  int64
+		mtime time.Time
+	}
+	buckets := make(map[bucket][]*group)
+	dirs := make([]string, 0)
+
+	err := filepath.WalkDir(c.root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			dirs = append(dirs, path)
+			return nil
+		}
+		if d.Name() == stampfile || strings.HasSuffix(d.Name(), "-temporary") || !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			// Concurrently removed.
+			return nil
+		}
+
+		b := bucket{info.Size(), info.ModTime()}
+		for _, g := range buckets[b] {
+			if os.SameFile(g.info, info) {
+				g.paths = append(g.paths, path)
+				return nil
+			}
+		}
+		buckets[b] = append(buckets[b], &group{paths: []string{path}, info: info})
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("can't sweep %s: %v", c.root, err)
+	}
+
+	groups := make([]*group, 0)
+	total := int64(0)
+	for _, gs := range buckets {
+		for _, g := range gs {
+			groups = append(groups, g)
+			total += g.info.Size()
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].info.ModTime().Before(groups[j].info.ModTime())
+	})
+
+	for _, g := range groups {
+		if total <= c.limit {
+			break
+		}
+		for _, p := range g.paths {
+			os.Remove(p)
+		}
+		total -= g.info.Size()
+	}
+
+	// Remove the directories emptied by eviction. Deeper directories
+	// come later in the walk. Removing a non-empty directory fails.
+	for i := len(dirs) - 1; i > 0; i-- {
+		os.Remove(dirs[i])
+	}
+	return nil
+}
+
+// Due is true if the cache hasn't been swept in interval.
+func (c *Cache) Due(interval time.Duration) bool {
+	fi, err := os.Stat(filepath.Join(c.root, stampfile))
+	return err != nil || time.Since(fi.ModTime()) >= interval
+}
+
+// SweepIfDue sweeps the cache if it hasn't been swept in interval. It
+// reports if it swept.
+func (c *Cache) SweepIfDue(interval time.Duration) (bool, error) {
+	if !c.Due(interval) {
+		return false, nil
+	}
+	stamp := filepath.Join(c.root, stampfile)
+
+	if err := os.MkdirAll(c.root, 0700); err != nil {
+		return false, fmt.Errorf("can't make %s: %v", c.root, err)
+	}
+	// Stamp first so that concurrent invocations don't also sweep.
+	now := time.Now()
+	if err := os.WriteFile(stamp, nil, 0600); err != nil {
+		return false, fmt.Errorf("can't stamp %s: %v", stamp, err)
+	}
+	os.Chtimes(stamp, now, now)
+	return true, c.Sweep()
+}
@@ -0,0 +1,149 @@
+package preview
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func write(t *testing.T, path, contents string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("can't make directory for %s: %v", path, err)
+	}
+	if err := os.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatalf("can't write %s: %v", path, err)
+	}
+}
+
+func blobs(t *testing.T, root string) []os.DirEntry {
+	t.Helper()
+	des, err := os.ReadDir(filepath.Join(root, blobdir))
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatalf("can't read blobs: %v", err)
+	}
+	return des
+}
+
+func TestPutDedupes(t *testing.T) {
+	src := t.TempDir()
+	root := t.TempDir()
+	write(t, filepath.Join(src, "a"), "same\n")
+	write(t, filepath.Join(src, "b"), "same\n")
+
+	c := New(root, DefaultLimit)
+	dests := []string{
+		filepath.Join(root, "glenda:1", "a"),
+		filepath.Join(root, "glenda:7", "a"),
+		filepath.Join(root, "glenda:2", "b"),
+	}
+	for i, d := range dests {
+		if err := c.Put(filepath.Join(src, []string{"a", "a", "b"}[i]), d); err != nil {
+			t.Fatalf("Put %s failed: %v", d, err)
+		}
+	}
+
+	if got, want := len(blobs(t, root)), 1; got != want {
+		t.Errorf("got %d blobs want %d", got, want)
+	}
+	first, err := os.Stat(dests[0])
+	if err != nil {
+		t.Fatalf("no preview: %v", err)
+	}
+	for _, d := range dests[1:] {
+		fi, err := os.Stat(d)
+		if err != nil {
+			t.Fatalf("no preview: %v", err)
+		}
+		if !os.SameFile(first, fi) {
+			t.Errorf("%s isn't linked to %s", d, dests[0])
+		}
+	}
+}
+
+func TestPutReplacesChangedFile(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "a")
+	root := t.TempDir()
+	dest := filepath.Join(root, "glenda:1", "a")
+
+	write(t, src, "before\n")
+	if err := New(root, DefaultLimit).Put(src, dest); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	write(t, src, "after\n")
+	if err := New(root, DefaultLimit).Put(src, dest); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	contents, err := os.ReadFile(dest)
+	if err != nil {
+		t.Fatalf("no preview: %v", err)
+	}
+	if got, want := string(contents), "after\n"; got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+}
+
+func TestSweepEvictsLeastRecentlyUsed(t *testing.T) {
+	src := t.TempDir()
+	root := t.TempDir()
+	c := New(root, 25)
+
+	// Each file is 10 bytes. Only two fit.
+	names := []string{"old", "middle", "new"}
+	for i, n := range names {
+		write(t, filepath.Join(src, n), n+"........."[len(n):])
+		dest := filepath.Join(root, "glenda:1", n)
+		if err := c.Put(filepath.Join(src, n), dest); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+		mtime := time.Now().Add(time.Duration(i-10) * time.Minute)
+		if err := os.Chtimes(dest, mtime, mtime); err != nil {
+			t.Fatalf("can't age %s: %v", dest, err)
+		}
+	}
+
+	if err := c.Sweep(); err != nil {
+		t.Fatalf("Sweep failed: %v", err)
+	}
+
+	for _, tv := range []struct {
+		name string
+		kept bool
+	}{
+		{"old", false},
+		{"middle", true},
+		{"new", true},
+	} {
+		_, err := os.Stat(filepath.Join(root, "glenda:1", tv.name))
+		if got := err == nil; got != tv.kept {
+			t.Errorf("%s kept got %v want %v", tv.name, got, tv.kept)
+		}
+	}
+	if got, want := len(blobs(t, root)), 2; got != want {
+		t.Errorf("got %d blobs want %d", got, want)
+	}
+
+	// Evicting everything removes the emptied directories.
+	if err := New(root, 0).Sweep(); err != nil {
+		t.Fatalf("Sweep failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "glenda:1")); !os.IsNotExist(err) {
+		t.Errorf("emptied directory wasn't removed: %v", err)
+	}
+}
+
+func TestSweepIfDue(t *testing.T) {
+	c := New(t.TempDir(), DefaultLimit)
+
+	if !c.Due(time.Hour) {
+		t.Errorf("a new cache should be due")
+	}
+	if swept, err := c.SweepIfDue(time.Hour); !swept || err != nil {
+		t.Errorf("SweepIfDue got %v, %v want true, nil", swept, err)
+	}
+	if swept, err := c.SweepIfDue(time.Hour); swept || err != nil {
+		t.Errorf("SweepIfDue got %v, %v want false, nil", swept, err)
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rjkroege/leap/base"
+	"github.com/rjkroege/leap/client"
+	"github.com/rjkroege/leap/git"
+	"github.com/rjkroege/leap/input"
+	"github.com/rjkroege/leap/output"
+	"github.com/rjkroege/leap/preview"
+	"github.com/rjkroege/leap/search"
+)
+
+// querySources runs query in the configured project (or every project)
+// and in the open Acme windows.
+func querySources(config *base.Configuration, qualifiers input.Qualifiers, query, trace string) []output.Entry {
+	logger := slog.With(base.TraceKey, trace)
+	scope, fn, stype, suffix := input.ParseScoped(query, contextPath(*context, search.AcmeWindows{}))
+
+	var entries []output.Entry
+	var err error
+	if *allprojects || qualifiers.All {
+		entries = queryAllProjects(config.GetNewConfiguration(), config, qualifiers, scope, fn, stype, suffix, trace)
+	} else if entries, err = queryProject(config, qualifiers, scope, fn, stype, suffix, trace); err != nil {
+		logger.Warn("query failed", "err", err)
+	}
+
+	// Open files are what I'm most likely looking for.
+	winfn := fn
+	if scope != nil {
+		winfn = scope
+	}
+	if windows, err := search.NewWindowSearch(preview.Default()).Query(winfn, stype, suffix, qualifiers.Changed); err != nil {
+		logger.Debug("not searching Acme windows", "err", err)
+	} else {
+		entries = search.WindowsAhead(windows, entries, search.MaximumMatches)
+	}
+	return entries
+}
+
+// queryProject runs the query in the project described by config. If
+// scope isn't nil, content queries are limited to the directory that it
+// matches. trace is the trace ID of the query.
+func queryProject(config *base.Configuration, qualifiers input.Qualifiers, scope, fn []string, stype, suffix, trace string) ([]output.Entry, error) {
+	stime := time.Now()
+	logger := slog.With(base.TraceKey, trace, "project", config.Project())
+	multi := search.NewMultiSearch(config.AllIndexes())
+	multi.UseLogger(logger)
+	if scope != nil {
+		multi.ScopeTo(scope)
+	}
+
+	// Remote projects search inside files and read git on the server.
+	remote := config.Connect && stype != ":"
+	usegit := config.Git || qualifiers.Changed
+	var inremotes *client.RemoteInternalSearcher
+	if remote || config.Connect && usegit {
+		// TODO(rjk): Dialing the remote can be expensive because ssh. I should overlap
+		// the connect with the search of the local index.
+		var err error
+		inremotes, err = client.NewRemoteInternalSearcher(config)
+		if err != nil && (remote || qualifiers.Changed) {
+			return nil, fmt.Errorf("problem connecting to server: %v", err)
+		} else if err != nil {
+			logger.Warn("not ranking by git activity", "err", err)
+		} else {
+			inremotes.SetTrace(trace)
+		}
+		logger.Debug("connected after NewRemoteInternalSearcher", "elapsed", time.Since(stime))
+	}
+
+	if usegit && inremotes != nil {
+		if err := inremotes.UseGit(multi, qualifiers.Changed, logger); err != nil {
+			return nil, err
+		}
+		logger.Debug("read remote git status", "elapsed", time.Since(stime))
+	} else if usegit && !config.Connect {
+		multi.UseGit(git.Read(git.Cmd{}, multi.Paths()), qualifiers.Changed)
+		logger.Debug("read git status", "elapsed", time.Since(stime))
+	}
+
+	if remote {
+		css := make([]search.ContentSearcher, 0)
+		for _, ix := range config.AllIndexes() {
+			css = append(css, inremotes.ForIndex(ix))
+		}
+		entries, err := multi.Query(fn, stype, []string{suffix}, css)
+		logger.Debug("query remote", "fn", fn, "stype", stype, "suffix", suffix, "elapsed", time.Since(stime))
+		if err == nil {
+			if cache, err := client.NewFileCache(config, inremotes); err != nil {
+				logger.Warn("no previews", "err", err)
+			} else if err := cache.Materialize(entries, config.AllRewrites()); err != nil {
+				logger.Warn("no previews", "err", err)
+			}
+			logger.Debug("materialized remote previews", "elapsed", time.Since(stime))
+		}
+		// Results are ranked by their paths on the server so rewrite them
+		// afterwards.
+		return client.RewriteEntries(entries, config.AllRewrites()), err
+	}
+
+	entries, err := multi.Query(fn, stype, []string{suffix}, nil)
+	logger.Debug("query local", "fn", fn, "stype", stype, "suffix", suffix, "elapsed", time.Since(stime))
+	if config.Connect {
+		// The local index is a copy of the server's.
+		entries = client.RewriteEntries(entries, config.AllRewrites())
+	}
+	return entries, err
+}
+
+// queryAllProjects runs the query in every project of gc at once. The
+// results are tagged with their project and interleaved so that the best
+// results of every project come first. Projects that fail are skipped.
+// current is the configuration of the current project.
+func queryAllProjects(gc *base.GlobalConfiguration, current *base.Configuration, qualifiers input.Qualifiers, scope, fn []string, stype, suffix, trace string) []output.Entry {
+	logger := slog.With(base.TraceKey, trace)
+	if gc == nil {
+		// An old style configuration only has one project.
+		entries, err := queryProject(current, qualifiers, scope, fn, stype, suffix, trace)
+		if err != nil {
+			logger.Warn("query failed", "err", err)
+		}
+		return entries
+	}
+
+	// The current project goes first.
+	names := []string{gc.Currentproject}
+	for _, n := range gc.ProjectNames() {
+		if n != gc.Currentproject {
+			names = append(names, n)
+		}
+	}
+
+	results := make([][]output.Entry, len(names))
+	var wg sync.WaitGroup
+	for i, name := range names {
+		config, err := gc.ProjectConfiguration(name)
+		if err != nil {
+			logger.Warn("skipping project", "err", err)
+			continue
+		}
+		if err := indexesExist(config); err != nil {
+			logger.Warn("skipping project", "project", name, "err", err)
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, name string, config *base.Configuration) {
+			defer wg.Done()
+			entries, err := queryProject(config, qualifiers, scope, fn, stype, suffix, trace)
+			if err != nil {
+				logger.Warn("query failed", "project", name, "err", err)
+				return
+			}
+			results[i] = output.Tag(entries, name)
+		}(i, name, config)
+	}
+	wg.Wait()
+
+	return output.Interleave(results, search.MaximumMatches)
+}
+
+// indexesExist checks that the indexes of config have been built. Opening
+// a missing index is fatal.
+func indexesExist(config *base.Configuration) error {
+	for _, ix := range config.AllIndexes() {
+		if _, err := os.Stat(ix.Indexpath); err != nil {
+			return fmt.Errorf("can't use index: %v", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package search
+
+import (
+	"log"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/codesearch/regexp"
+	"github.com/rjkroege/leap/base"
+	"github.com/rjkroege/leap/output"
+)
+
+// resolveBookmark returns the line of bm. For bookmarks of a regexp, it's
+// the first line of the file that matches or 0 if none do.
+func resolveBookmark(bm base.Bookmark) int {
+	if bm.Regexp == "" {
+		return bm.Line
+	}
+	re, err := regexp.Compile("(?m)" + bm.Regexp)
+	if err != nil {
+		log.Printf("bad bookmark regexp %q: %v", bm.Regexp, err)
+		return 0
+	}
+	matches, err := searchInFile(re, bm.Path)
+	if err != nil || len(matches) == 0 {
+		log.Printf("can't find %q in %s: %v", bm.Regexp, bm.Path, err)
+		return 0
+	}
+	return matches[0].lineno
+}
+
+// Bookmarks returns the results for the bookmarks in marks whose names
+// start with prefix, ordered by name.
+func Bookmarks(marks map[string]string, prefix string) []output.Entry {
+	names := make([]string, 0, len(marks))
+	for n := range marks {
+		if strings.HasPrefix(n, prefix) {
+			names = append(names, n)
+		}
+	}
+	sort.Strings(names)
+
+	oo := make([]output.Entry, 0, len(names))
+	for _, n := range names {
+		bm, err := base.ParseBookmark(marks[n])
+		if err != nil {
+			log.Printf("skipping bookmark %s: %v", n, err)
+			continue
+		}
+		suffix := ""
+		if line := resolveBookmark(bm); line > 0 {
+			suffix = strconv.Itoa(line)
+		}
+		oo = append(oo, output.Entry{
+			Uid:          "'" + n,
+			Arg:          extend(bm.Path, suffix),
+			AutoComplete: "'" + n,
+			Title:        n,
+			SubTitle:     extend(filepath.Base(bm.Path), suffix) + " " + marks[n],
+			Type:         "file:skipcheck",
+			Icon: output.AlfredIcon{
+				Filename: determineIconString(bm.Path),
+			},
+		})
+	}
+	return oo
+}
@@ -0,0 +1,46 @@
+package search
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestBookmarks(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "main.go")
+	if err := os.WriteFile(file, []byte("package main\n\nfunc main() {\n}\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	marks := map[string]string{
+		"main":    file + ":/^func main/",
+		"mainpkg": file + ":1",
+		"missing": file + ":/nothere/",
+		"other":   "/elsewhere/x.go",
+	}
+
+	got := Bookmarks(marks, "m")
+	args := make([]string, 0)
+	for _, e := range got {
+		args = append(args, e.Title+"="+e.Arg)
+	}
+	if want := []string{
+		"main=" + file + ":3",
+		"mainpkg=" + file + ":1",
+		"missing=" + file,
+	}; !reflect.DeepEqual(args, want) {
+		t.Errorf("got %v want %v", args, want)
+	}
+	if got[0].Uid != "'main" || got[0].AutoComplete != "'main" {
+		t.Errorf("unexpected entry %#v", got[0])
+	}
+
+	if got := Bookmarks(marks, ""); len(got) != 4 {
+		t.Errorf("empty prefix got %d bookmarks want 4", len(got))
+	}
+	if got := Bookmarks(nil, "x"); len(got) != 0 {
+		t.Errorf("no bookmarks got %v", got)
+	}
+}
@@ -2,26 +2,42 @@ package search
 
 import (
 	"fmt"
-	"io"
 	"log"
-	"os"
+	"log/slog"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/google/codesearch/index"
 	"github.com/google/codesearch/regexp"
 	"github.com/rjkroege/leap/base"
+	"github.com/rjkroege/leap/git"
+	leapindex "github.com/rjkroege/leap/index"
 	"github.com/rjkroege/leap/output"
+	"github.com/rjkroege/leap/preview"
 )
 
 const MaximumMatches = 50
 
 type Search struct {
 	name string
-	index.Index
+	*leapindex.Index
 	prefixes  []string
 	trimpaths [][]byte
+	dirs      []indexedDir
+
+	// Optional git state used to rank and filter results.
+	gitstatus   *git.Status
+	changedonly bool
+
+	// Where ContentSearchResult puts copies of the matched files. nil
+	// when the results are for another machine where local copies are
+	// useless.
+	previews *preview.Cache
+
+	// If not empty, only files in this directory are matched.
+	scope string
 }
 
 func (ix *Search) GetName() string {
@@ -40,6 +56,13 @@ func (ix *Search) filterFileIndicesForRegexpMatch(post []uint32, re *regexp.Rege
 		name := ix.NameBytes(fileid)
 		sname := ix.trimmer(name)
 
+		if ix.changedonly && !ix.gitstatus.Changed(string(name)) {
+			continue
+		}
+		if ix.scope != "" && !under(ix.scope, string(name)) {
+			continue
+		}
+
 		if re.Match(sname, true, true) >= 0 {
 			fnames = append(fnames, fileid)
 			continue
@@ -49,15 +72,16 @@ func (ix *Search) filterFileIndicesForRegexpMatch(post []uint32, re *regexp.Rege
 }
 
 // reorderMatchByFuzziness reorders the matches to be in increasing order
-// of fuzziness so that best matches appear first.
-func (ix *Search) reorderMatchByFuzziness(matches []uint32, fnls []string) ([]uint32, error) {
+// of fuzziness so that best matches appear first. It also returns the
+// score of each reordered match: smaller scores are better matches.
+func (ix *Search) reorderMatchByFuzziness(matches []uint32, fnls []string) ([]uint32, []int, error) {
 	res := make([]*regexp.Regexp, len(fnls))
 	reordered := make([][]uint32, len(res))
 	for i := range res {
 		reordered[i] = make([]uint32, 0, len(matches))
 		fre, err := regexp.Compile(fnls[i])
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 		res[i] = fre
 	}
@@ -75,48 +99,102 @@ outer:
 		reordered[len(res)-1] = append(reordered[len(res)-1], fileid)
 	}
 
-	result := reordered[0]
-	for _, r := range reordered[1:] {
-		result = append(result, r...)
+	// Within a level of fuzziness, prefer files that are being worked on.
+	if ix.gitstatus != nil {
+		for _, r := range reordered {
+			sort.SliceStable(r, func(i, j int) bool {
+				return ix.gitstatus.Rank(ix.Name(r[i])) < ix.gitstatus.Rank(ix.Name(r[j]))
+			})
+		}
 	}
-	return result, nil
+
+	result := make([]uint32, 0, len(matches))
+	scores := make([]int, 0, len(matches))
+	for level, r := range reordered {
+		for _, fileid := range r {
+			result = append(result, fileid)
+			scores = append(scores, level*(git.Untouched+1)+ix.gitstatus.Rank(ix.Name(fileid)))
+		}
+	}
+	return result, scores, nil
 }
 
 // NewTrigramSearch returns a Generator that can search
 // inside of files using index at path and project truncation
 // prefixes.
 func NewTrigramSearch(path string, prefixes []string) *Search {
-	return &Search{path, *index.Open(path), prefixes, nil}
+	ix, err := OpenTrigramSearch(path, prefixes)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return ix
 }
 
-type ContentSearcher interface {
-	ContentSearchResult(fnames []uint32, re *regexp.Regexp, suffix string) ([]output.Entry, error)
+// OpenTrigramSearch is NewTrigramSearch for callers that can recover
+// from an unreadable index.
+func OpenTrigramSearch(path string, prefixes []string) (*Search, error) {
+	ix, err := leapindex.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Search{
+		name:     path,
+		Index:    ix,
+		prefixes: prefixes,
+		previews: preview.Default(),
+	}, nil
 }
 
-// Query searches for the specified fn (file name) patterns and suffix
-// (in content) patterns. The patterns should be arranged in descending
-// order of desirability. Entires satisfying the set of search queries
-// are returned or error. The ContentSearcher implementation will be used
-// to remote searches into the interior of files.
-// TODO(rjk): divide this code into two functions based on suffix?
-func (ix *Search) Query(fnl []string, qtype string, suffixl []string, cs ContentSearcher) ([]output.Entry, error) {
-	suffix := suffixl[0]
+// Close releases the index. ix can't be used afterwards.
+func (ix *Search) Close() error {
+	return ix.Index.Close()
+}
 
-	stime := time.Now()
+// UseGit makes Query rank files with git activity in st ahead of others.
+// If changedonly is true, Query only returns files changed in the working
+// tree or on the current branch.
+func (ix *Search) UseGit(st *git.Status, changedonly bool) {
+	ix.gitstatus = st
+	ix.changedonly = changedonly
+}
 
-	// TODO(rjk): code seems vaguely unclean
-	// Produce a list of filename, all or content-matches only.
-	var query *index.Query
-	var re *regexp.Regexp
-	pat := ""
+// DisablePreviews stops ContentSearchResult from copying matched files
+// into the encoded paths under base.Prefix. The server uses this because
+// its copies would be on the wrong machine.
+func (ix *Search) DisablePreviews() {
+	ix.previews = nil
+}
+
+type ContentSearcher interface {
+	ContentSearchResult(fnames []uint32, re *regexp.Regexp, suffix string) ([]output.Entry, error)
+}
+
+// contentRegexp compiles the content search pattern for a query of
+// type qtype. Filename-only queries have no pattern.
+func contentRegexp(qtype, suffix string) (*regexp.Regexp, string, error) {
+	if qtype == ":" {
+		return nil, "", nil
+	}
+	pat := "(?m)" + suffix
+	re, err := regexp.Compile(pat)
+	if err != nil {
+		return nil, "", err
+	}
+	return re, pat, nil
+}
 
+// matchFiles finds the files in the index satisfying the filename
+// patterns fnl and (if not nil) the content regexp re. The files are
+// returned best first with their scores.
+func (ix *Search) matchFiles(fnl []string, re *regexp.Regexp) ([]uint32, []int, error) {
 	// TODO(rjk): Explore having different (extended) search properties.
 	// In essence, I want to do the search as if the argument is a filename
 	// or something in a file.
 	// TODO(rjk): I want some easy way to bound the number of responses
 	// I can look at the search complexity and switch to regexp mode if
 	// it's insufficiently complicated.
-	if qtype == ":" {
+	var query *index.Query
+	if re == nil {
 		// This is a filename-only search.
 		query = &index.Query{Op: index.QAll}
 
@@ -126,12 +204,6 @@ func (ix *Search) Query(fnl []string, qtype string, suffixl []string, cs Content
 		// Chrome is an atypically large use case.
 	} else {
 		// This is a contents search. Warmish-runs take 17ms on Chrome.
-		pat = "(?m)" + suffix
-		var err error
-		re, err = regexp.Compile(pat)
-		if err != nil {
-			return nil, err
-		}
 		query = index.RegexpQuery(re.Syntax)
 	}
 	post := ix.PostingQuery(query)
@@ -143,7 +215,7 @@ func (ix *Search) Query(fnl []string, qtype string, suffixl []string, cs Content
 	melded := strings.Join(fnl, "|")
 	fre, err := regexp.Compile(melded)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	// This is O(n) over the list of candidate files. That would be all of the
@@ -151,14 +223,33 @@ func (ix *Search) Query(fnl []string, qtype string, suffixl []string, cs Content
 	fnames = ix.filterFileIndicesForRegexpMatch(post, fre, fnames)
 
 	// Reorder the results for better quality.
-	if fnames, err = ix.reorderMatchByFuzziness(fnames, fnl); err != nil {
-		return nil, err
-	}
+	return ix.reorderMatchByFuzziness(fnames, fnl)
+}
 
+// Query searches for the specified fn (file name) patterns and suffix
+// (in content) patterns. The patterns should be arranged in descending
+// order of desirability. Entires satisfying the set of search queries
+// are returned or error. The ContentSearcher implementation will be used
+// to remote searches into the interior of files.
+func (ix *Search) Query(fnl []string, qtype string, suffixl []string, cs ContentSearcher) ([]output.Entry, error) {
+	suffix := suffixl[0]
+
+	stime := time.Now()
 	defer func() {
-		log.Printf("Query %v, %v, %v tool outputstate total %v", fnl, qtype, suffixl, time.Since(stime))
+		slog.Debug("Search.Query", "index", ix.GetName(), "fnl", fnl, "qtype", qtype, "suffixl", suffixl,
+			"elapsed", time.Since(stime))
 	}()
 
+	re, pat, err := contentRegexp(qtype, suffix)
+	if err != nil {
+		return nil, err
+	}
+
+	fnames, _, err := ix.matchFiles(fnl, re)
+	if err != nil {
+		return nil, err
+	}
+
 	if qtype == ":" {
 		// Filename results do not actually require the files.
 		// If we have the index locally, we would appear to not
@@ -252,42 +343,19 @@ func (ix *Search) ContentSearchResult(fnames []uint32, re *regexp.Regexp, _ stri
 			},
 		})
 
+		if ix.previews == nil {
+			continue
+		}
+
 		// TODO(rjk): make icons for C++ etc. work correctly here.
 		// The golang icons work? They do. They're part of the workflow.
 		// I can make custom icons, put in the workflow and save the copies.
 		// This will simplify the "remote-i-fying"
 		// Copy the content to the prefix so that icons work properly.
-		// TODO(rjk): this doesn't work right for remote?
-		dir := filepath.Dir(arg)
-		if err := os.MkdirAll(dir, 0700); err != nil {
-			log.Println(dir, err)
-			continue
-		}
-		if err := fileCopy(name, arg); err != nil {
+		// Remote results get their copies from client.FileCache.
+		if err := ix.previews.Put(name, arg); err != nil {
 			log.Println(name, arg, err)
-			continue
 		}
 	}
 	return oo, nil
 }
-
-// TODO(rjk): Remove this code?
-func fileCopy(a, b string) error {
-	sFile, err := os.Open(a)
-	if err != nil {
-		return err
-	}
-	defer sFile.Close()
-
-	eFile, err := os.Create(b)
-	if err != nil {
-		return err
-	}
-	defer eFile.Close()
-
-	_, err = io.Copy(eFile, sFile) // first var shows number of bytes
-	if err != nil {
-		return err
-	}
-	return nil
-}
@@ -0,0 +1,108 @@
+package search
+
+import (
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/google/codesearch/index"
+	"github.com/google/codesearch/regexp"
+	"github.com/rjkroege/leap/git"
+	"github.com/rjkroege/leap/output"
+)
+
+// indexedDir is a directory containing indexed files and its trimmed
+// name with a trailing /.
+type indexedDir struct {
+	dir   string
+	tname []byte
+}
+
+// indexedDirs returns the directories of the indexed files below the
+// roots of the index in index order.
+func (ix *Search) indexedDirs() []indexedDir {
+	if ix.dirs != nil {
+		// Cached because every filename query needs them.
+		return ix.dirs
+	}
+	seen := make(map[string]bool)
+	ix.dirs = make([]indexedDir, 0)
+	for _, fileid := range ix.PostingQuery(&index.Query{Op: index.QAll}) {
+		for dir := path.Dir(ix.Name(fileid)); !seen[dir]; dir = path.Dir(dir) {
+			seen[dir] = true
+			tname := ix.trimmer([]byte(dir + "/"))
+			if len(tname) == 0 || tname[0] == '/' {
+				// At or above the root of the index.
+				break
+			}
+			ix.dirs = append(ix.dirs, indexedDir{dir: dir, tname: tname})
+		}
+	}
+	return ix.dirs
+}
+
+// matchDirs finds the directories of the indexed files that satisfy the
+// filename patterns fnl. A directory's trimmed name (with a trailing /)
+// is matched. The best MaximumMatches directories are returned best first
+// with their scores. A directory scores better than the files matched by
+// the same pattern.
+func (ix *Search) matchDirs(fnl []string) ([]string, []int, error) {
+	res := make([]*regexp.Regexp, len(fnl))
+	for i := range fnl {
+		re, err := regexp.Compile(fnl[i])
+		if err != nil {
+			return nil, nil, err
+		}
+		res[i] = re
+	}
+
+	levels := make([][]string, len(res))
+	for _, d := range ix.indexedDirs() {
+		for i, re := range res {
+			if re.Match(d.tname, true, true) >= 0 {
+				levels[i] = append(levels[i], d.dir)
+				break
+			}
+		}
+	}
+
+	dirs := make([]string, 0, MaximumMatches)
+	scores := make([]int, 0, MaximumMatches)
+	for level, l := range levels {
+		// Prefer the directory containing the others.
+		sort.SliceStable(l, func(i, j int) bool {
+			return len(l[i]) < len(l[j])
+		})
+		for _, d := range l {
+			if len(dirs) >= MaximumMatches {
+				return dirs, scores, nil
+			}
+			dirs = append(dirs, d)
+			scores = append(scores, level*(git.Untouched+1)-1)
+		}
+	}
+	return dirs, scores, nil
+}
+
+// dirResult makes the result for the directory dir. It opens as a
+// directory window.
+func (ix *Search) dirResult(dir string) output.Entry {
+	name := dir + "/"
+	return output.Entry{
+		Uid:          name,
+		Arg:          name,
+		AutoComplete: string(ix.trimmer([]byte(name))),
+		Title:        path.Base(dir) + "/",
+		SubTitle:     string(ix.trimmer([]byte(name))),
+		Type:         "file:skipcheck",
+		Icon: output.AlfredIcon{
+			Filename: dir,
+			Type:     "fileicon",
+		},
+	}
+}
+
+// under is true if the file name is inside the directory dir.
+func under(dir, name string) bool {
+	return strings.HasPrefix(name, strings.TrimSuffix(dir, "/")+"/")
+}
@@ -0,0 +1,104 @@
+package search
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/rjkroege/leap/base"
+	"github.com/rjkroege/leap/input"
+)
+
+func makeTreeSearch(t *testing.T) (*MultiSearch, string) {
+	tree, ixpath := makeSyntheticIndex(t, map[string]string{
+		"pkg/server/token.go":     "package server\n\ntype Token int\n",
+		"pkg/server/auth/auth.go": "package auth\n\nvar Token = 1\n",
+		"pkg/client/token.go":     "package client\n\ntype Token int\n",
+		"serve.go":                "package main\n",
+	})
+	return NewMultiSearch([]base.Index{{Indexpath: ixpath, Prefixes: []string{tree}}}), tree
+}
+
+func TestDirectoryResults(t *testing.T) {
+	ms, tree := makeTreeSearch(t)
+
+	got, err := ms.Query([]string{"pkg/server/[^/]*$", "pkg/server/"}, ":", []string{""}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error on query: %v\n", err)
+	}
+	// The directory comes before the files in it.
+	if got, want := titles(got), []string{"server/", "token.go", "auth/", "auth.go"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v expected %v", got, want)
+	}
+
+	dir := got[0]
+	if want := filepath.Join(tree, "pkg/server") + "/"; dir.Arg != want || dir.Uid != want {
+		t.Errorf("directory Arg %q Uid %q expected %q", dir.Arg, dir.Uid, want)
+	}
+	if dir.AutoComplete != "pkg/server/" || dir.SubTitle != "pkg/server/" || dir.Icon.Type != "fileicon" {
+		t.Errorf("unexpected directory result %#v", dir)
+	}
+
+	// Content queries don't find directories.
+	got, err = ms.Query([]string{"serv[^/]*$", "serv"}, "/", []string{"package"}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error on query: %v\n", err)
+	}
+	for _, e := range got {
+		if e.Icon.Type == "fileicon" {
+			t.Errorf("content query found directory %v", e.Uid)
+		}
+	}
+}
+
+func TestScopedContentQuery(t *testing.T) {
+	ms, tree := makeTreeSearch(t)
+	scope, query := input.Scope("pkg/serv/:/Token")
+	ms.ScopeTo(scope)
+
+	fn, stype, suffix := input.Parse(query)
+	got, err := ms.Query(fn, stype, []string{suffix}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error on query: %v\n", err)
+	}
+	// Only the files under pkg/server in index order.
+	uids := make([]string, 0)
+	for _, e := range got {
+		uids = append(uids, e.Uid)
+	}
+	if want := []string{
+		filepath.Join(tree, "pkg/server/auth/auth.go:3"),
+		filepath.Join(tree, "pkg/server/token.go:3"),
+	}; !reflect.DeepEqual(uids, want) {
+		t.Errorf("got %v expected %v", uids, want)
+	}
+
+	ms.ScopeTo([]string{"nothere/"})
+	got, err = ms.Query(fn, stype, []string{suffix}, nil)
+	if err != nil || len(got) != 0 {
+		t.Errorf("scope matching no directory got %v, %v", got, err)
+	}
+}
+
+func TestMatchDirsRanksBeforeTruncating(t *testing.T) {
+	files := map[string]string{"zz/zz.go": "package zz\n"}
+	for i := 0; i < MaximumMatches+10; i++ {
+		files[fmt.Sprintf("d%02d/zz/zz.go", i)] = "package zz\n"
+	}
+	tree, ixpath := makeSyntheticIndex(t, files)
+	ix := NewTrigramSearch(ixpath, []string{tree})
+	defer ix.Close()
+
+	// The best match is last in the index.
+	dirs, scores, err := ix.matchDirs([]string{"^zz/$", "zz/$"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(dirs) != MaximumMatches || len(scores) != MaximumMatches {
+		t.Fatalf("got %d dirs and %d scores want %d", len(dirs), len(scores), MaximumMatches)
+	}
+	if want := filepath.Join(tree, "zz"); dirs[0] != want || scores[0] >= scores[1] {
+		t.Errorf("best dir got %s (%d) want %s ahead of %s (%d)", dirs[0], scores[0], want, dirs[1], scores[1])
+	}
+}
@@ -2,7 +2,9 @@ package search
 
 import (
 	"bytes"
+	"path"
 	"path/filepath"
+	"strings"
 
 	"github.com/rjkroege/leap/output"
 )
@@ -51,22 +53,85 @@ func extend(base, suffix string) string {
 	return base
 }
 
+// ambiguous is true if the leap query q would match other as well as
+// it matches the file that it was made for. q matches the end of a
+// file's name in the best (filename only) fuzzy matcher.
+func ambiguous(q, other string) bool {
+	i := strings.LastIndex(other, q)
+	return i >= 0 && !strings.Contains(other[i+len(q):], "/")
+}
+
+// autoCompletions returns a leap query for each of the trimmed file names
+// that narrows the search towards that file. It's the shortest trailing
+// part of the name (in whole path elements) that matches none of the
+// other names. When there's no such query, it's the file's directory so
+// that the search continues in that directory.
+func autoCompletions(names []string) []string {
+	acs := make([]string, len(names))
+outer:
+	for i, name := range names {
+		for j := strings.LastIndex(name, "/"); ; j = strings.LastIndex(name[:j], "/") {
+			q := name[j+1:]
+			unique := true
+			for k, other := range names {
+				if k != i && ambiguous(q, other) {
+					unique = false
+					break
+				}
+			}
+			if unique {
+				acs[i] = q
+				continue outer
+			}
+			if j < 0 {
+				break
+			}
+		}
+		if dir := path.Dir(name); dir != "." {
+			acs[i] = dir + "/"
+		} else {
+			acs[i] = name
+		}
+	}
+	return acs
+}
+
+// completion returns the AutoComplete for the auto completion ac of a
+// query with suffix.
+func completion(ac, suffix string) string {
+	if strings.HasSuffix(ac, "/") {
+		// Narrowing to a directory drops the line.
+		return ac
+	}
+	return extend(ac, suffix)
+}
+
+// setAutoComplete sets the AutoComplete of each of the filename results in
+// entries from the corresponding trimmed name in names.
+func setAutoComplete(entries []output.Entry, names []string, suffix string) {
+	for i, ac := range autoCompletions(names) {
+		entries[i].AutoComplete = completion(ac, suffix)
+	}
+}
+
 func (ix *Search) filenameResult(fnames []uint32, suffix string) ([]output.Entry, error) {
 	// TODO(rjk): Consider a better way to find the pretty sub-name:
 	// such as the shortest unique prefix.
 	oo := make([]output.Entry, 0, MaximumMatches)
+	trimmed := make([]string, 0, len(fnames))
 
 	for _, fn := range fnames {
 		name := ix.NameBytes(fn)
 		sname := string(name)
 		title := filepath.Base(sname)
+		tname := string(ix.trimmer(name))
+		trimmed = append(trimmed, tname)
 
 		oo = append(oo, output.Entry{
-			Uid:   sname,
-			Arg:   extend(sname, suffix),
-			Title: extend(title, suffix),
-			// Makes a temporary string.
-			SubTitle: extend(string(ix.trimmer(name)), suffix),
+			Uid:      sname,
+			Arg:      extend(sname, suffix),
+			Title:    extend(title, suffix),
+			SubTitle: extend(tname, suffix),
 
 			Type: "file:skipcheck",
 			Icon: output.AlfredIcon{
@@ -74,5 +139,6 @@ func (ix *Search) filenameResult(fnames []uint32, suffix string) ([]output.Entry
 			},
 		})
 	}
+	setAutoComplete(oo, trimmed, suffix)
 	return oo, nil
 }
@@ -0,0 +1,67 @@
+package search
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/rjkroege/leap/base"
+)
+
+func TestAutoCompletions(t *testing.T) {
+	for _, tv := range []struct {
+		names []string
+		want  []string
+	}{
+		{[]string{"a/b/foo.go"}, []string{"foo.go"}},
+		{
+			[]string{"server/foo.go", "client/foo.go", "client/bar.go"},
+			[]string{"server/foo.go", "client/foo.go", "bar.go"},
+		},
+		// xfoo.go would also be found by foo.go.
+		{[]string{"a/foo.go", "b/xfoo.go"}, []string{"a/foo.go", "xfoo.go"}},
+		// The same name in two indexes narrows to the directory.
+		{[]string{"pkg/x/a.go", "pkg/x/a.go"}, []string{"pkg/x/", "pkg/x/"}},
+		{[]string{"a.go", "a.go"}, []string{"a.go", "a.go"}},
+	} {
+		if got := autoCompletions(tv.names); !reflect.DeepEqual(got, tv.want) {
+			t.Errorf("autoCompletions(%v) got %v want %v", tv.names, got, tv.want)
+		}
+	}
+}
+
+func autoCompletes(t *testing.T, ms *MultiSearch, fnl []string, suffix string) map[string]string {
+	got, err := ms.Query(fnl, ":", []string{suffix}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error on query: %v\n", err)
+	}
+	acs := make(map[string]string)
+	for _, e := range got {
+		acs[e.SubTitle] = e.AutoComplete
+	}
+	return acs
+}
+
+func TestFileNameAutoComplete(t *testing.T) {
+	tree, ixpath := makeSyntheticIndex(t, map[string]string{
+		"server/handler.go": "package server\n",
+		"client/handler.go": "package client\n",
+		"client/call.go":    "package client\n",
+	})
+	ms := NewMultiSearch([]base.Index{{Indexpath: ixpath, Prefixes: []string{tree}}})
+
+	if got, want := autoCompletes(t, ms, []string{"a[^/]*$", "a"}, ""), map[string]string{
+		"server/handler.go": "server/handler.go",
+		"client/handler.go": "client/handler.go",
+		"client/call.go":    "call.go",
+	}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v want %v", got, want)
+	}
+
+	// The line is kept.
+	if got, want := autoCompletes(t, ms, []string{"call[^/]*$"}, "12"), map[string]string{
+		"client/call.go:12": "call.go:12",
+	}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v want %v", got, want)
+	}
+
+}
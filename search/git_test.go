@@ -0,0 +1,55 @@
+package search
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/rjkroege/leap/git"
+)
+
+func TestGitRankedFileNameQuery(t *testing.T) {
+	tree, ixpath := makeSyntheticIndex(t, map[string]string{
+		"a/alpha.go":   "package a\n",
+		"a/apple.go":   "package a\n",
+		"b/avocado.go": "package b\n",
+	})
+
+	st := git.NewStatus()
+	st.Add(filepath.Join(tree, "b/avocado.go"), git.Modified)
+	st.Add(filepath.Join(tree, "a/apple.go"), git.Recent)
+
+	gen := NewTrigramSearch(ixpath, nil)
+	gen.UseGit(st, false)
+
+	got, err := gen.Query([]string{"a[^/]*$"}, ":", []string{""}, gen)
+	if err != nil {
+		t.Fatalf("unexpected error on query: %v\n", err)
+	}
+	if got, want := titles(got), []string{"avocado.go", "apple.go", "alpha.go"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v exepcted %v", got, want)
+	}
+}
+
+func TestGitChangedOnlyFileNameQuery(t *testing.T) {
+	tree, ixpath := makeSyntheticIndex(t, map[string]string{
+		"a/alpha.go":   "package a\n",
+		"a/apple.go":   "package a\n",
+		"b/avocado.go": "package b\n",
+	})
+
+	st := git.NewStatus()
+	st.Add(filepath.Join(tree, "a/apple.go"), git.OnBranch)
+	st.Add(filepath.Join(tree, "b/avocado.go"), git.Recent)
+
+	gen := NewTrigramSearch(ixpath, nil)
+	gen.UseGit(st, true)
+
+	got, err := gen.Query([]string{"a[^/]*$"}, ":", []string{""}, gen)
+	if err != nil {
+		t.Fatalf("unexpected error on query: %v\n", err)
+	}
+	if got, want := titles(got), []string{"apple.go"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v exepcted %v", got, want)
+	}
+}
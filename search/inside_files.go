@@ -37,7 +37,12 @@ func searchInFile(re *regexp.Regexp, name string) ([]*inFileMatches, error) {
 		return nil, err
 	}
 	defer f.Close()
+	return searchInReader(re, name, f)
+}
 
+// searchInReader finds the lines matching re in the contents of the file
+// name read from f.
+func searchInReader(re *regexp.Regexp, name string, f io.Reader) ([]*inFileMatches, error) {
 	matches := make([]*inFileMatches, 0, MaximumMatches)
 
 	var (
@@ -0,0 +1,283 @@
+package search
+
+import (
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rjkroege/leap/base"
+	"github.com/rjkroege/leap/git"
+	"github.com/rjkroege/leap/output"
+)
+
+// MultiSearch queries several indexes as if they were one.
+type MultiSearch struct {
+	searches []*Search
+
+	// Patterns choosing the directory that content searches are limited
+	// to.
+	scope []string
+
+	logger *slog.Logger
+}
+
+// NewMultiSearch opens each of the indexes described by ixs.
+func NewMultiSearch(ixs []base.Index) *MultiSearch {
+	ms := &MultiSearch{
+		searches: make([]*Search, 0, len(ixs)),
+		logger:   slog.Default(),
+	}
+	for _, ix := range ixs {
+		ms.searches = append(ms.searches, NewTrigramSearch(ix.Indexpath, ix.Prefixes))
+	}
+	return ms
+}
+
+// Searches returns the Search for each index in the order given to
+// NewMultiSearch.
+func (ms *MultiSearch) Searches() []*Search {
+	return ms.searches
+}
+
+// Paths returns the roots of all of the indexes.
+func (ms *MultiSearch) Paths() []string {
+	paths := make([]string, 0)
+	for _, ix := range ms.searches {
+		paths = append(paths, ix.Paths()...)
+	}
+	return paths
+}
+
+// UseGit applies Search.UseGit to every index.
+func (ms *MultiSearch) UseGit(st *git.Status, changedonly bool) {
+	for _, ix := range ms.searches {
+		ix.UseGit(st, changedonly)
+	}
+}
+
+// ScopeTo limits content searches to the directory best matching the
+// filename patterns fnl.
+func (ms *MultiSearch) ScopeTo(fnl []string) {
+	ms.scope = fnl
+}
+
+// UseLogger makes Query log to logger. Use it to add the trace ID of the
+// query to the records.
+func (ms *MultiSearch) UseLogger(logger *slog.Logger) {
+	ms.logger = logger
+}
+
+// candidate is a file (or, if dir is set, a directory) from one of the
+// indexes that satisfies a query.
+type candidate struct {
+	which  int
+	fileid uint32
+	dir    string
+	score  int
+}
+
+// name returns the path of the file or directory of c.
+func (ms *MultiSearch) name(c candidate) string {
+	if c.dir != "" {
+		return c.dir + "/"
+	}
+	return ms.searches[c.which].Name(c.fileid)
+}
+
+// bestDir returns the directory in any of the indexes that best matches
+// the filename patterns fnl.
+func (ms *MultiSearch) bestDir(fnl []string) (string, error) {
+	best, bestscore := "", 0
+	for _, ix := range ms.searches {
+		dirs, scores, err := ix.matchDirs(fnl)
+		if err != nil {
+			return "", err
+		}
+		if len(dirs) > 0 && (best == "" || scores[0] < bestscore) {
+			best, bestscore = dirs[0], scores[0]
+		}
+	}
+	return best, nil
+}
+
+// Query is like Search.Query but fans out across all of the indexes,
+// merges their results and ranks them together. css provides the
+// ContentSearcher for each index. If css (or an entry in it) is nil, the
+// index's Search searches its own files.
+func (ms *MultiSearch) Query(fnl []string, qtype string, suffixl []string, css []ContentSearcher) ([]output.Entry, error) {
+	suffix := suffixl[0]
+
+	stime := time.Now()
+	defer func() {
+		ms.logger.Debug("MultiSearch.Query", "fnl", fnl, "qtype", qtype, "suffixl", suffixl,
+			"indexes", len(ms.searches), "elapsed", time.Since(stime))
+	}()
+
+	// Validate the content pattern once before fanning out.
+	_, pat, err := contentRegexp(qtype, suffix)
+	if err != nil {
+		return nil, err
+	}
+
+	if ms.scope != nil && qtype != ":" {
+		dir, err := ms.bestDir(ms.scope)
+		if err != nil {
+			return nil, err
+		}
+		if dir == "" {
+			return []output.Entry{}, nil
+		}
+		ms.logger.Debug("MultiSearch.Query limited", "dir", dir)
+		for _, ix := range ms.searches {
+			ix.scope = dir
+		}
+	}
+
+	// Each index is searched concurrently. The regexp implementation
+	// caches state so every goroutine compiles its own.
+	fileids := make([][]uint32, len(ms.searches))
+	scores := make([][]int, len(ms.searches))
+	dirs := make([][]string, len(ms.searches))
+	dirscores := make([][]int, len(ms.searches))
+	errs := make([]error, len(ms.searches))
+	var wg sync.WaitGroup
+	for i, ix := range ms.searches {
+		wg.Add(1)
+		go func(i int, ix *Search) {
+			defer wg.Done()
+			re, _, err := contentRegexp(qtype, suffix)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			fileids[i], scores[i], errs[i] = ix.matchFiles(fnl, re)
+			if errs[i] == nil && re == nil && !ix.changedonly {
+				// Directories are also results of filename queries.
+				dirs[i], dirscores[i], errs[i] = ix.matchDirs(fnl)
+			}
+		}(i, ix)
+	}
+	wg.Wait()
+
+	// Merge the candidates best first. Ties keep the order of the
+	// indexes. The same file can be in more than one index.
+	candidates := make([]candidate, 0)
+	for i := range ms.searches {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		for j, fileid := range fileids[i] {
+			candidates = append(candidates, candidate{which: i, fileid: fileid, score: scores[i][j]})
+		}
+		for j, dir := range dirs[i] {
+			candidates = append(candidates, candidate{which: i, dir: dir, score: dirscores[i][j]})
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].score < candidates[j].score
+	})
+
+	seen := make(map[string]bool)
+	ranked := make([]candidate, 0, MaximumMatches)
+	for _, c := range candidates {
+		if len(ranked) >= MaximumMatches {
+			break
+		}
+		name := ms.name(c)
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		ranked = append(ranked, c)
+	}
+
+	if qtype == ":" {
+		entries := make([]output.Entry, 0, len(ranked))
+		fileat := make([]int, 0, len(ranked))
+		trimmed := make([]string, 0, len(ranked))
+		for _, c := range ranked {
+			ix := ms.searches[c.which]
+			if c.dir != "" {
+				entries = append(entries, ix.dirResult(c.dir))
+				continue
+			}
+			es, err := ix.filenameResult([]uint32{c.fileid}, suffix)
+			if err != nil {
+				return nil, err
+			}
+			fileat = append(fileat, len(entries))
+			entries = append(entries, es...)
+			trimmed = append(trimmed, string(ix.trimmer(ix.NameBytes(c.fileid))))
+		}
+		// Completions must distinguish the results of all of the indexes.
+		for i, ac := range autoCompletions(trimmed) {
+			entries[fileat[i]].AutoComplete = completion(ac, suffix)
+		}
+		return entries, nil
+	}
+	return ms.contentSearch(ranked, qtype, suffix, pat, css)
+}
+
+// contentSearch confirms the ranked candidates by searching inside of
+// them. The searches of each index happen concurrently. The results are
+// ordered by the rank of the file containing them.
+func (ms *MultiSearch) contentSearch(ranked []candidate, qtype, suffix, pat string, css []ContentSearcher) ([]output.Entry, error) {
+	perindex := make([][]uint32, len(ms.searches))
+	rank := make(map[string]int, len(ranked))
+	for i, c := range ranked {
+		perindex[c.which] = append(perindex[c.which], c.fileid)
+		rank[ms.searches[c.which].Name(c.fileid)] = i
+	}
+
+	results := make([][]output.Entry, len(ms.searches))
+	errs := make([]error, len(ms.searches))
+	var wg sync.WaitGroup
+	for i, ix := range ms.searches {
+		if len(perindex[i]) == 0 {
+			continue
+		}
+		var cs ContentSearcher = ix
+		if i < len(css) && css[i] != nil {
+			cs = css[i]
+		}
+
+		wg.Add(1)
+		go func(i int, cs ContentSearcher) {
+			defer wg.Done()
+			re, _, err := contentRegexp(qtype, suffix)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			results[i], errs[i] = cs.ContentSearchResult(perindex[i], re, pat)
+		}(i, cs)
+	}
+	wg.Wait()
+
+	entries := make([]output.Entry, 0)
+	for i := range ms.searches {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		entries = append(entries, results[i]...)
+	}
+
+	// Content results have a Uid of file:lineno.
+	sort.SliceStable(entries, func(i, j int) bool {
+		return rank[uidFile(entries[i].Uid)] < rank[uidFile(entries[j].Uid)]
+	})
+	if len(entries) > MaximumMatches {
+		entries = entries[:MaximumMatches]
+	}
+	return entries, nil
+}
+
+// uidFile returns the file part of a content result's Uid.
+func uidFile(uid string) string {
+	if i := strings.LastIndexByte(uid, ':'); i >= 0 {
+		return uid[:i]
+	}
+	return uid
+}
@@ -0,0 +1,79 @@
+package search
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/rjkroege/leap/base"
+	"github.com/rjkroege/leap/git"
+)
+
+func makeMultiSearch(t *testing.T) (*MultiSearch, string, string) {
+	atree, apath := makeSyntheticIndex(t, map[string]string{
+		"alpha.go": "package a\n\nfunc Alpha() {}\n",
+		"zeta.go":  "package a\n",
+	})
+	btree, bpath := makeSyntheticIndex(t, map[string]string{
+		"apple.go":   "package b\n\nfunc Apple() {}\n",
+		"banana.go":  "package b\n",
+		"avocado.go": "package b\n\nfunc Avocado() {}\n",
+	})
+	return NewMultiSearch([]base.Index{
+		{Indexpath: apath, Prefixes: []string{atree}},
+		{Indexpath: bpath, Prefixes: []string{btree}},
+	}), atree, btree
+}
+
+func TestMultiFileNameQuery(t *testing.T) {
+	ms, _, btree := makeMultiSearch(t)
+
+	st := git.NewStatus()
+	st.Add(filepath.Join(btree, "avocado.go"), git.Modified)
+	ms.UseGit(st, false)
+
+	got, err := ms.Query([]string{"^a[^/]*$", "a[^/]*$"}, ":", []string{""}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error on query: %v\n", err)
+	}
+
+	// Files in both indexes are ranked together. Equally good matches
+	// keep the order of the indexes.
+	if got, want := titles(got), []string{"avocado.go", "alpha.go", "apple.go", "zeta.go", "banana.go"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v exepcted %v", got, want)
+	}
+}
+
+func TestMultiContentQuery(t *testing.T) {
+	ms, _, _ := makeMultiSearch(t)
+
+	got, err := ms.Query([]string{"^a[^/]*$", "[^/]*$"}, "/", []string{"^func A"}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error on query: %v\n", err)
+	}
+	if got, want := titles(got), []string{"3 func Alpha() {}\n", "3 func Apple() {}\n", "3 func Avocado() {}\n"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v exepcted %v", got, want)
+	}
+}
+
+func TestMultiBadContentRegexp(t *testing.T) {
+	ms, _, _ := makeMultiSearch(t)
+
+	if _, err := ms.Query([]string{"[^/]*$"}, "/", []string{"func ("}, nil); err == nil {
+		t.Errorf("expected an error for a bad content regexp")
+	}
+}
+
+func TestUidFile(t *testing.T) {
+	for _, tv := range []struct {
+		uid  string
+		want string
+	}{
+		{"/a/b.go:12", "/a/b.go"},
+		{"/a/b.go", "/a/b.go"},
+	} {
+		if got := uidFile(tv.uid); got != tv.want {
+			t.Errorf("uidFile(%q) got %q want %q", tv.uid, got, tv.want)
+		}
+	}
+}
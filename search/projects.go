@@ -0,0 +1,81 @@
+package search
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rjkroege/leap/base"
+	"github.com/rjkroege/leap/output"
+)
+
+// indexAge describes how long ago the least recently built index of p
+// was built.
+func indexAge(p *base.Project, now time.Time) string {
+	var oldest time.Time
+	for _, ix := range p.AllIndexes() {
+		if ix.Indexpath == "" {
+			return "not indexed"
+		}
+		fi, err := os.Stat(ix.Indexpath)
+		if err != nil {
+			return "not indexed"
+		}
+		if oldest.IsZero() || fi.ModTime().Before(oldest) {
+			oldest = fi.ModTime()
+		}
+	}
+
+	switch d := now.Sub(oldest); {
+	case d < time.Minute:
+		return "indexed just now"
+	case d < time.Hour:
+		return fmt.Sprintf("indexed %dm ago", int(d.Minutes()))
+	case d < 48*time.Hour:
+		return fmt.Sprintf("indexed %dh ago", int(d.Hours()))
+	default:
+		return fmt.Sprintf("indexed %dd ago", int(d.Hours()/24))
+	}
+}
+
+// Projects returns a result for each project of gc whose name starts
+// with prefix: the current project first and then the others by name.
+// The argument of a result is the project's name so that choosing it can
+// run leap project use to make it current.
+func Projects(gc *base.GlobalConfiguration, prefix string, now time.Time) []output.Entry {
+	names := make([]string, 0, len(gc.Projects))
+	for _, n := range gc.ProjectNames() {
+		if strings.HasPrefix(n, prefix) {
+			names = append(names, n)
+		}
+	}
+	sort.SliceStable(names, func(i, j int) bool {
+		return names[i] == gc.Currentproject && names[j] != gc.Currentproject
+	})
+
+	oo := make([]output.Entry, 0, len(names))
+	for _, n := range names {
+		p := gc.Projects[n]
+		title := n
+		if n == gc.Currentproject {
+			title += " (current)"
+		}
+		host, mode := p.Host, "local"
+		if host == "" {
+			host = "in-memory"
+		}
+		if p.Remote {
+			mode = "remote"
+		}
+		oo = append(oo, output.Entry{
+			Uid:          "project:" + n,
+			Arg:          n,
+			AutoComplete: n,
+			Title:        title,
+			SubTitle:     strings.Join([]string{host, mode, indexAge(p, now)}, " · "),
+		})
+	}
+	return oo
+}
@@ -0,0 +1,60 @@
+package search
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/rjkroege/leap/base"
+)
+
+func TestProjects(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	fresh := filepath.Join(dir, "fresh")
+	stale := filepath.Join(dir, "stale")
+	for f, mtime := range map[string]time.Time{
+		fresh: now.Add(-5 * time.Minute),
+		stale: now.Add(-72 * time.Hour),
+	} {
+		if err := os.WriteFile(f, nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(f, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	gc := &base.GlobalConfiguration{
+		Currentproject: "web",
+		Projects: map[string]*base.Project{
+			"api":     {Host: "build", Remote: true, Indexpath: fresh},
+			"web":     {Indexpath: fresh, Indexes: []base.Index{{Indexpath: stale}}},
+			"wiki":    {Host: "build", Indexpath: filepath.Join(dir, "missing")},
+			"scratch": {},
+		},
+	}
+
+	got := Projects(gc, "", now)
+	lines := make([]string, 0)
+	for _, e := range got {
+		lines = append(lines, e.Arg+"|"+e.Title+"|"+e.SubTitle)
+	}
+	if want := []string{
+		"web|web (current)|in-memory · local · indexed 3d ago",
+		"api|api|build · remote · indexed 5m ago",
+		"scratch|scratch|in-memory · local · not indexed",
+		"wiki|wiki|build · local · not indexed",
+	}; !reflect.DeepEqual(lines, want) {
+		t.Errorf("got %v want %v", lines, want)
+	}
+	if got[1].Uid != "project:api" || got[1].AutoComplete != "api" {
+		t.Errorf("unexpected entry %#v", got[1])
+	}
+
+	if got := Projects(gc, "w", now); len(got) != 2 || got[1].Arg != "wiki" {
+		t.Errorf("prefix w got %v", got)
+	}
+}
@@ -64,7 +64,7 @@ func TestOneMatchFileNameOnlyQuery(t *testing.T) {
 		Arg:          tDir("test_data/b/ccc.txt"),
 		Type:         "file",
 		Valid:        "",
-		AutoComplete: "",
+		AutoComplete: "ccc.txt",
 		Title:        "ccc.txt",
 		SubTitle:     "b/ccc.txt",
 		Icon:         output.AlfredIcon{Filename: "/Applications/TextEdit.app/Contents/Resources/txt.icns"},
@@ -89,7 +89,7 @@ func TestOneMatchFileNameLineNumberQuery(t *testing.T) {
 		Arg:          tDir("test_data/b/ccc.txt:2"),
 		Type:         "file",
 		Valid:        "",
-		AutoComplete: "",
+		AutoComplete: "ccc.txt:2",
 		Title:        "ccc.txt:2",
 		SubTitle:     "b/ccc.txt:2",
 		Icon:         output.AlfredIcon{Filename: "/Applications/TextEdit.app/Contents/Resources/txt.icns"}}}
@@ -159,7 +159,7 @@ func TestOneMatchFileNameLineNumberQueryWithPrefix(t *testing.T) {
 		Arg:          tDir("test_data/b/ccc.txt:2"),
 		Type:         "file",
 		Valid:        "",
-		AutoComplete: "",
+		AutoComplete: "ccc.txt:2",
 		Title:        "ccc.txt:2",
 		SubTitle:     "test_data/b/ccc.txt:2",
 		Icon:         output.AlfredIcon{Filename: "/Applications/TextEdit.app/Contents/Resources/txt.icns"}}}
@@ -185,7 +185,7 @@ func TestOneMatchFileNameLineNumberQueryWithSlashedPrefix(t *testing.T) {
 		Arg:          tDir("test_data/b/ccc.txt:2"),
 		Type:         "file",
 		Valid:        "",
-		AutoComplete: "",
+		AutoComplete: "ccc.txt:2",
 		Title:        "ccc.txt:2",
 		SubTitle:     "test_data/b/ccc.txt:2",
 		Icon:         output.AlfredIcon{Filename: "/Applications/TextEdit.app/Contents/Resources/txt.icns"}}}
@@ -303,7 +303,7 @@ func TestMultiRegexpFileNameOnlyQuery(t *testing.T) {
 			Arg:          tDir("test_data/b", fn),
 			Type:         "file",
 			Valid:        "",
-			AutoComplete: "",
+			AutoComplete: fn,
 			Title:        fn,
 			SubTitle:     "b/" + fn,
 			Icon:         output.AlfredIcon{Filename: "/Applications/TextEdit.app/Contents/Resources/txt.icns"},
@@ -0,0 +1,65 @@
+package search
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/codesearch/index"
+	"github.com/rjkroege/leap/output"
+)
+
+// makeSyntheticIndex writes files (relative path to contents) into a
+// temporary directory and indexes them. It returns the directory and the
+// path of the index. Unlike test_index, the paths in the index are valid
+// wherever the test runs.
+func makeSyntheticIndex(t *testing.T, files map[string]string) (string, string) {
+	root := t.TempDir()
+	for name, contents := range files {
+		p := filepath.Join(root, "tree", name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatalf("can't make directory for %s: %v", p, err)
+		}
+		if err := os.WriteFile(p, []byte(contents), 0644); err != nil {
+			t.Fatalf("can't write %s: %v", p, err)
+		}
+	}
+
+	tree := filepath.Join(root, "tree")
+	indexpath := filepath.Join(root, "index")
+	ix := index.Create(indexpath)
+	ix.AddPaths([]string{tree})
+	if err := filepath.Walk(tree, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			ix.AddFile(path)
+		}
+		return nil
+	}); err != nil {
+		t.Fatalf("can't walk %s: %v", tree, err)
+	}
+	ix.Flush()
+	return tree, indexpath
+}
+
+// titles returns the Title of each result.
+func titles(results []output.Entry) []string {
+	ts := make([]string, 0, len(results))
+	for _, r := range results {
+		ts = append(ts, r.Title)
+	}
+	return ts
+}
+
+func TestClose(t *testing.T) {
+	tree, indexpath := makeSyntheticIndex(t, map[string]string{"a.go": "package a\n"})
+	ix := NewTrigramSearch(indexpath, nil)
+	if got := ix.Paths(); len(got) != 1 || got[0] != tree {
+		t.Errorf("Paths got %v want [%s]", got, tree)
+	}
+	if err := ix.Close(); err != nil {
+		t.Errorf("Close got error %v", err)
+	}
+}
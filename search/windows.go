@@ -0,0 +1,232 @@
+package search
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"9fans.net/go/acme"
+	"github.com/google/codesearch/regexp"
+	"github.com/rjkroege/leap/base"
+	"github.com/rjkroege/leap/output"
+	"github.com/rjkroege/leap/preview"
+)
+
+// Window is an open Acme (or Edwood) window.
+type Window struct {
+	ID       int
+	Name     string
+	Modified bool
+}
+
+// WindowLister lets me mock out Acme.
+type WindowLister interface {
+	Windows() ([]Window, error)
+	Body(id int) ([]byte, error)
+}
+
+// AcmeWindows lists the windows of the running Acme via its 9P
+// filesystem.
+type AcmeWindows struct{}
+
+func (_ AcmeWindows) Windows() ([]Window, error) {
+	infos, err := acme.Windows()
+	if err != nil {
+		return nil, err
+	}
+	wins := make([]Window, 0, len(infos))
+	for _, wi := range infos {
+		if wi.IsDir {
+			continue
+		}
+		wins = append(wins, Window{ID: wi.ID, Name: wi.Name, Modified: wi.IsModified})
+	}
+	return wins, nil
+}
+
+func (_ AcmeWindows) Body(id int) ([]byte, error) {
+	w, err := acme.Open(id, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer w.CloseFiles()
+	return w.ReadAll("body")
+}
+
+// WindowSearch searches the files open in the editor. The bodies of the
+// windows are searched so unsaved changes are found.
+type WindowSearch struct {
+	lister   WindowLister
+	previews *preview.Cache
+}
+
+// NewWindowSearch makes a WindowSearch of the windows of the running Acme
+// that puts previews of the matched windows in previews. previews can be
+// nil.
+func NewWindowSearch(previews *preview.Cache) *WindowSearch {
+	return &WindowSearch{
+		lister:   AcmeWindows{},
+		previews: previews,
+	}
+}
+
+// matchWindows returns the windows whose names satisfy the filename
+// patterns fnl, best matches first. Special windows (such as +Errors)
+// are skipped.
+func matchWindows(wins []Window, fnl []string, changedonly bool) ([]Window, error) {
+	res := make([]*regexp.Regexp, len(fnl))
+	for i, fn := range fnl {
+		re, err := regexp.Compile(fn)
+		if err != nil {
+			return nil, err
+		}
+		res[i] = re
+	}
+
+	levels := make([][]Window, len(res))
+	for _, w := range wins {
+		if !filepath.IsAbs(w.Name) || strings.HasPrefix(filepath.Base(w.Name), "+") {
+			continue
+		}
+		if changedonly && !w.Modified {
+			continue
+		}
+		for i, re := range res {
+			if re.Match([]byte(w.Name), true, true) >= 0 {
+				levels[i] = append(levels[i], w)
+				break
+			}
+		}
+	}
+
+	matched := make([]Window, 0)
+	for _, l := range levels {
+		matched = append(matched, l...)
+	}
+	return matched, nil
+}
+
+// Query searches the open windows like Search.Query. If changedonly,
+// only windows with unsaved changes are searched. The results are tagged
+// as coming from Acme.
+func (ws *WindowSearch) Query(fnl []string, qtype string, suffix string, changedonly bool) ([]output.Entry, error) {
+	wins, err := ws.lister.Windows()
+	if err != nil {
+		return nil, fmt.Errorf("can't list windows: %v", err)
+	}
+	matched, err := matchWindows(wins, fnl, changedonly)
+	if err != nil {
+		return nil, err
+	}
+
+	re, _, err := contentRegexp(qtype, suffix)
+	if err != nil {
+		return nil, err
+	}
+
+	oo := make([]output.Entry, 0, len(matched))
+	for _, w := range matched {
+		if len(oo) >= MaximumMatches {
+			break
+		}
+		if re == nil {
+			oo = append(oo, output.Entry{
+				Uid:      w.Name,
+				Arg:      extend(w.Name, suffix),
+				Title:    extend(filepath.Base(w.Name), suffix),
+				SubTitle: extend(w.Name, suffix),
+				Type:     "file:skipcheck",
+				Icon: output.AlfredIcon{
+					Filename: determineIconString(w.Name),
+				},
+			})
+			continue
+		}
+
+		body, err := ws.lister.Body(w.ID)
+		if err != nil {
+			log.Printf("can't read body of window %s: %v", w.Name, err)
+			continue
+		}
+		matches, err := searchInReader(re, w.Name, bytes.NewReader(body))
+		if err != nil {
+			log.Println("window search error: ", err)
+			continue
+		}
+		args := make([]string, 0, len(matches))
+		for _, m := range matches {
+			arg := fmt.Sprintf("/%s:%d%s", base.Prefix, m.lineno, m.fn)
+			args = append(args, arg)
+			oo = append(oo, output.Entry{
+				Uid:      fmt.Sprintf("%s:%d", m.fn, m.lineno),
+				Arg:      arg,
+				Title:    fmt.Sprintf("%d %s", m.lineno, m.matchLine),
+				SubTitle: fmt.Sprintf("%s:%d %s", m.fn, m.lineno, m.matchLine),
+				Type:     "file",
+				Icon: output.AlfredIcon{
+					Filename: determineIconString(m.fn),
+				},
+			})
+		}
+		ws.preview(body, args)
+	}
+	if len(oo) > MaximumMatches {
+		oo = oo[:MaximumMatches]
+	}
+	return output.Tag(oo, "acme"), nil
+}
+
+// preview puts previews of the (possibly unsaved) body of a window at
+// the encoded paths args.
+func (ws *WindowSearch) preview(body []byte, args []string) {
+	if ws.previews == nil || len(args) == 0 {
+		return
+	}
+	f, err := os.CreateTemp("", "leap-window-")
+	if err != nil {
+		log.Println("can't preview window: ", err)
+		return
+	}
+	defer os.Remove(f.Name())
+	_, err = f.Write(body)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		log.Println("can't preview window: ", err)
+		return
+	}
+	for _, arg := range args {
+		if err := ws.previews.Put(f.Name(), arg); err != nil {
+			log.Println(f.Name(), arg, err)
+		}
+	}
+}
+
+// WindowsAhead puts the results from the open windows ahead of the
+// results from the indexes, dropping the index results for the files
+// open in windows because the windows may have unsaved changes. At most
+// limit results are returned.
+func WindowsAhead(windows, indexed []output.Entry, limit int) []output.Entry {
+	open := make(map[string]bool, len(windows))
+	for _, e := range windows {
+		open[uidFile(e.Uid)] = true
+		open[e.Uid] = true
+	}
+
+	oo := make([]output.Entry, 0, len(windows)+len(indexed))
+	oo = append(oo, windows...)
+	for _, e := range indexed {
+		if open[e.Uid] || open[uidFile(e.Uid)] {
+			continue
+		}
+		oo = append(oo, e)
+	}
+	if len(oo) > limit {
+		oo = oo[:limit]
+	}
+	return oo
+}
@@ -0,0 +1,139 @@
+package search
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/rjkroege/leap/base"
+	"github.com/rjkroege/leap/output"
+	"github.com/rjkroege/leap/preview"
+)
+
+type fakeLister struct {
+	wins   []Window
+	bodies map[int]string
+}
+
+func (f *fakeLister) Windows() ([]Window, error) {
+	return f.wins, nil
+}
+
+func (f *fakeLister) Body(id int) ([]byte, error) {
+	b, ok := f.bodies[id]
+	if !ok {
+		return nil, fmt.Errorf("no window %d", id)
+	}
+	return []byte(b), nil
+}
+
+func makeWindowSearch() *WindowSearch {
+	return &WindowSearch{
+		lister: &fakeLister{
+			wins: []Window{
+				{ID: 1, Name: "/src/proj/zeta/alpha.go"},
+				{ID: 2, Name: "/src/proj/apple.go", Modified: true},
+				{ID: 3, Name: "/src/proj/+Errors"},
+				{ID: 4, Name: "banana.go"},
+			},
+			bodies: map[int]string{
+				1: "package zeta\n\nfunc Alpha() {}\n",
+				2: "package proj\n\n// Unsaved.\nfunc Apple() {}\n",
+			},
+		},
+	}
+}
+
+func TestWindowFileNameQuery(t *testing.T) {
+	ws := makeWindowSearch()
+
+	got, err := ws.Query([]string{"a[^/]*$", "a"}, ":", "", false)
+	if err != nil {
+		t.Fatalf("unexpected error on query: %v\n", err)
+	}
+	// Both windows match "a" in the filename; the special and unnamed
+	// windows are skipped.
+	if got, want := titles(got), []string{"alpha.go", "apple.go"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v expected %v", got, want)
+	}
+	if got, want := got[0].SubTitle, "[acme] /src/proj/zeta/alpha.go"; got != want {
+		t.Errorf("got subtitle %q expected %q", got, want)
+	}
+
+	// zeta only matches alpha.go's directory so it's a worse match.
+	got, err = ws.Query([]string{"z[^/]*$", "z"}, ":", "12", false)
+	if err != nil {
+		t.Fatalf("unexpected error on query: %v\n", err)
+	}
+	if got, want := titles(got), []string{"alpha.go:12"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v expected %v", got, want)
+	}
+
+	got, err = ws.Query([]string{"a[^/]*$", "a"}, ":", "", true)
+	if err != nil {
+		t.Fatalf("unexpected error on query: %v\n", err)
+	}
+	if got, want := titles(got), []string{"apple.go"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("changed only got %v expected %v", got, want)
+	}
+}
+
+func TestWindowContentQuery(t *testing.T) {
+	ws := makeWindowSearch()
+	root := t.TempDir()
+	ws.previews = preview.New(root, preview.DefaultLimit)
+
+	got, err := ws.Query([]string{"[^/]*$"}, "/", "Unsaved|func A", false)
+	if err != nil {
+		t.Fatalf("unexpected error on query: %v\n", err)
+	}
+	if got, want := titles(got), []string{"3 func Alpha() {}\n", "3 // Unsaved.\n", "4 func Apple() {}\n"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v expected %v", got, want)
+	}
+
+	// The previews are the unsaved bodies.
+	for _, e := range got {
+		defer os.Remove(e.Arg)
+	}
+	b, err := os.ReadFile(got[1].Arg)
+	if err != nil {
+		t.Fatalf("no preview: %v", err)
+	}
+	if string(b) != "package proj\n\n// Unsaved.\nfunc Apple() {}\n" {
+		t.Errorf("preview got %q", b)
+	}
+	if got[1].Arg != "/"+base.Prefix+":3/src/proj/apple.go" {
+		t.Errorf("unexpected preview path %q", got[1].Arg)
+	}
+
+	if _, err := ws.Query([]string{"[^/]*$"}, "/", "func (", false); err == nil {
+		t.Errorf("expected an error for a bad content regexp")
+	}
+}
+
+func TestWindowsAhead(t *testing.T) {
+	windows := []output.Entry{
+		{Uid: "/a/b.go:3"},
+		{Uid: "/a/c.go"},
+	}
+	indexed := []output.Entry{
+		{Uid: "/a/b.go:4"},
+		{Uid: "/a/c.go"},
+		{Uid: "/a/d.go:1"},
+		{Uid: "/a/e.go:1"},
+	}
+
+	got := WindowsAhead(windows, indexed, 4)
+	uids := make([]string, 0)
+	for _, e := range got {
+		uids = append(uids, e.Uid)
+	}
+	if want := []string{"/a/b.go:3", "/a/c.go", "/a/d.go:1", "/a/e.go:1"}; !reflect.DeepEqual(uids, want) {
+		t.Errorf("got %v expected %v", uids, want)
+	}
+
+	if got := WindowsAhead(windows, indexed, 3); len(got) != 3 {
+		t.Errorf("got %d results expected the limit of 3", len(got))
+	}
+}
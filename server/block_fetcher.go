@@ -1,25 +1,19 @@
 package server
 
-import (
-	"fmt"
-)
+import "time"
 
 type DoRequestArgs struct {
 	Start, End int64
-	Token      int
+	// Token is the ID of the transfer session.
+	Token int
 }
 
 // DoRequestOnServer runs on the server and returns the requested blocks.
-func (t *Server) DoRequestOnServer(req DoRequestArgs, resp *[]byte) error {
-	if t.token == 0 || t.token != req.Token {
-		return fmt.Errorf("token mis-match: new sync before last one is done")
-	}
-
-	e := req.End
-	s := req.Start
+func (t *Server) DoRequestOnServer(req DoRequestArgs, resp *[]byte) (err error) {
+	defer func(stime time.Time) { t.stats.observe("DoRequestOnServer", stime, err) }(time.Now())
 
-	buffy := make([]byte, e-s)
-	if _, err := t.indexfile.ReadAt(buffy, s); err != nil {
+	buffy, err := t.sessions.read(req.Token, req.Start, req.End)
+	if err != nil {
 		return err
 	}
 
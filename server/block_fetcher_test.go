@@ -28,9 +28,9 @@ func TestDoRequestOnServer(t *testing.T) {
 		err:      nil,
 	}
 
-	server := &Server{
-		indexfile: file,
-		token:     1,
+	server := new(Server)
+	if id := server.sessions.begin("index", file, int64(len(buffercontents))); id != 1 {
+		t.Fatalf("first session got ID %d want 1", id)
 	}
 
 	var result []byte
@@ -63,12 +63,12 @@ func TestDoRequestOnServer(t *testing.T) {
 		contents: buffercontents,
 		err:      fmt.Errorf("fake failure"),
 	}
-	server.indexfile = brokenfile
+	server.sessions.begin("index", brokenfile, int64(len(buffercontents)))
 	var result3 []byte
 	if err := server.DoRequestOnServer(DoRequestArgs{
 		Start: int64(len(buffercontents) - 6),
 		End:   int64(len(buffercontents)),
-		Token: 1,
+		Token: 2,
 	}, &result3); err == nil {
 		t.Errorf("expected error")
 	} else {
@@ -2,8 +2,11 @@ package server
 
 import (
 	"fmt"
+	"log/slog"
+	"time"
 
 	"github.com/google/codesearch/regexp"
+	"github.com/rjkroege/leap/base"
 	"github.com/rjkroege/leap/output"
 )
 
@@ -12,26 +15,39 @@ type ContentSearchResultArgs struct {
 	Suffix      string
 	Prefixes    []string
 	Remoteindex string
+	// Trace is the trace ID of the client's query.
+	Trace string
 }
 
 type ContentSearchResult struct {
 	Entries []output.Entry
 }
 
-func (s *Server) RemoteContentSearchResult(args ContentSearchResultArgs, resp *ContentSearchResult) error {
+func (s *Server) RemoteContentSearchResult(args ContentSearchResultArgs, resp *ContentSearchResult) (err error) {
+	stime := time.Now()
+	logger := slog.With(base.TraceKey, args.Trace)
+	defer func() {
+		s.stats.observe("RemoteContentSearchResult", stime, err)
+		logger.Info("RemoteContentSearchResult", "index", args.Remoteindex, "files", len(args.Fnames),
+			"results", len(resp.Entries), "elapsed", time.Since(stime))
+	}()
+
 	// Make sure that we are using the most recent index data. We do this
 	// here instead of making it part of the index implementation because I
 	// might have run cindex.
-	if err := s.ensureValidSearchObject(args.Remoteindex, args.Prefixes); err != nil {
+	search, release, err := s.indexes.acquire(args.Remoteindex, args.Prefixes)
+	if err != nil {
 		return fmt.Errorf("server can't make search object for %s: %v", args.Remoteindex, err)
 	}
+	defer release()
 
 	re, err := regexp.Compile(args.Suffix)
 	if err != nil {
 		return fmt.Errorf("can't compile regexp on server: %v", err)
 	}
-	entries, err := s.search.ContentSearchResult(args.Fnames, re, "")
+	entries, err := search.ContentSearchResult(args.Fnames, re, "")
 	if err != nil {
+		logger.Warn("can't search inside files", "index", args.Remoteindex, "err", err)
 		return fmt.Errorf("can't run Search.ContentSearchResult on server: %v", err)
 	}
 
@@ -0,0 +1,75 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"time"
+
+	"github.com/rjkroege/leap/base"
+	"github.com/rjkroege/leap/export"
+)
+
+type ExportArgs struct {
+	Indexes []base.Index
+}
+
+type ExportResult struct {
+	// Port is where the server answers 9P connections.
+	Port int
+}
+
+// Export makes the trees of args.Indexes available over 9P. They're
+// read-only unless the server was started allowing writes. The server
+// must have been started with an export address.
+func (s *Server) Export(args ExportArgs, resp *ExportResult) (err error) {
+	defer func(stime time.Time) { s.stats.observe("Export", stime, err) }(time.Now())
+
+	if s.exportaddr == "" {
+		return fmt.Errorf("server isn't exporting files: start it with -export")
+	}
+
+	roots := make([]string, 0)
+	for _, ix := range args.Indexes {
+		search, release, err := s.indexes.acquire(ix.Remotepath, ix.Prefixes)
+		if err != nil {
+			return fmt.Errorf("server can't make search object for %s: %v", ix.Remotepath, err)
+		}
+		roots = append(roots, search.Paths()...)
+		release()
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.exporter == nil {
+		addr := listenAddr(s.exportaddr)
+		l, err := net.Listen("tcp", addr)
+		if err != nil {
+			return fmt.Errorf("can't listen for 9P on %s: %v", addr, err)
+		}
+		s.exporter = export.New()
+		if s.exportwrite {
+			s.exporter.AllowWrites()
+		}
+		s.exportport = l.Addr().(*net.TCPAddr).Port
+		go func(exporter *export.Server) {
+			log.Println("export stopped: ", exporter.Serve(l))
+		}(s.exporter)
+	}
+	s.exporter.AddRoots(roots...)
+	log.Printf("exporting %v on port %d", roots, s.exportport)
+
+	resp.Port = s.exportport
+	return nil
+}
+
+// listenAddr is addr on the loopback interface unless it names a host:
+// the export has no authentication so other machines must be let in
+// explicitly.
+func listenAddr(addr string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || host != "" {
+		return addr
+	}
+	return net.JoinHostPort("127.0.0.1", port)
+}
@@ -0,0 +1,16 @@
+package server
+
+import "testing"
+
+func TestListenAddr(t *testing.T) {
+	for addr, want := range map[string]string{
+		":5640":          "127.0.0.1:5640",
+		"0.0.0.0:5640":   "0.0.0.0:5640",
+		"buildhost:5640": "buildhost:5640",
+		"[::]:5640":      "[::]:5640",
+	} {
+		if got := listenAddr(addr); got != want {
+			t.Errorf("listenAddr(%q) got %q want %q", addr, got, want)
+		}
+	}
+}
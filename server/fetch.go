@@ -0,0 +1,131 @@
+package server
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rjkroege/leap/base"
+)
+
+// FileRequest asks for the contents of the file at Path. If the client
+// already has a copy with ModTime, the contents are not sent.
+type FileRequest struct {
+	Path    string
+	ModTime time.Time
+}
+
+type FetchFilesArgs struct {
+	Files []FileRequest
+	// Only files in the trees of these indexes can be fetched.
+	Indexes []base.Index
+	// Limit caps the total number of bytes of file contents in the reply.
+	Limit int64
+	// Trace is the trace ID of the client's query.
+	Trace string
+}
+
+// FetchedFile is the server's copy of a requested file. Contents is nil
+// if the client's copy is current (NotModified) or the file wouldn't fit
+// in the limit (Skipped.)
+type FetchedFile struct {
+	Path        string
+	ModTime     time.Time
+	Size        int64
+	Contents    []byte
+	NotModified bool
+	Skipped     bool
+	Err         string
+}
+
+type FetchFilesResult struct {
+	Files []FetchedFile
+}
+
+// FetchFiles sends the client the contents of files in the trees indexed
+// by args.Indexes so that it can make previews of them.
+func (s *Server) FetchFiles(args FetchFilesArgs, resp *FetchFilesResult) (err error) {
+	stime := time.Now()
+	defer func() {
+		s.stats.observe("FetchFiles", stime, err)
+		slog.Info("FetchFiles", base.TraceKey, args.Trace, "files", len(args.Files), "elapsed", time.Since(stime))
+	}()
+
+	roots := make([]string, 0)
+	for _, ix := range args.Indexes {
+		search, release, err := s.indexes.acquire(ix.Remotepath, ix.Prefixes)
+		if err != nil {
+			return fmt.Errorf("server can't make search object for %s: %v", ix.Remotepath, err)
+		}
+		roots = append(roots, search.Paths()...)
+		release()
+	}
+	// Symlinks are followed so that they can't reach outside of the roots.
+	real := make([]string, 0, len(roots))
+	for _, r := range roots {
+		if rr, err := filepath.EvalSymlinks(r); err == nil {
+			real = append(real, rr)
+		}
+	}
+
+	budget := args.Limit
+	resp.Files = make([]FetchedFile, len(args.Files))
+	for i, req := range args.Files {
+		f := &resp.Files[i]
+		f.Path = req.Path
+
+		if !under(roots, req.Path) {
+			f.Err = fmt.Sprintf("%s is not in the index", req.Path)
+			continue
+		}
+		path, err := filepath.EvalSymlinks(req.Path)
+		if err != nil {
+			f.Err = err.Error()
+			continue
+		}
+		if !under(real, path) {
+			f.Err = fmt.Sprintf("%s is not in the index", req.Path)
+			continue
+		}
+
+		fi, err := s.fs.Stat(path)
+		if err != nil {
+			f.Err = err.Error()
+			continue
+		}
+		f.ModTime = fi.ModTime()
+		f.Size = fi.Size()
+
+		switch {
+		case !fi.Mode().IsRegular():
+			f.Err = fmt.Sprintf("%s is not a file", req.Path)
+		case f.ModTime.Equal(req.ModTime):
+			f.NotModified = true
+		case f.Size > budget:
+			f.Skipped = true
+		default:
+			contents, err := os.ReadFile(path)
+			if err != nil {
+				f.Err = err.Error()
+				continue
+			}
+			f.Contents = contents
+			budget -= int64(len(contents))
+		}
+	}
+	return nil
+}
+
+// under is true if path is inside one of the directories roots.
+func under(roots []string, path string) bool {
+	path = filepath.Clean(path)
+	for _, r := range roots {
+		if path == r || strings.HasPrefix(path, strings.TrimSuffix(r, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,107 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rjkroege/leap/base"
+	"github.com/rjkroege/leap/index"
+)
+
+func TestFetchFiles(t *testing.T) {
+	root := t.TempDir()
+	tree := filepath.Join(root, "tree")
+	if err := os.MkdirAll(tree, 0755); err != nil {
+		t.Fatalf("can't make %s: %v", tree, err)
+	}
+	for name, contents := range map[string]string{
+		"small": "small\n",
+		"big":   "a bigger file than the limit\n",
+		"same":  "unchanged\n",
+	} {
+		if err := os.WriteFile(filepath.Join(tree, name), []byte(contents), 0644); err != nil {
+			t.Fatalf("can't write %s: %v", name, err)
+		}
+	}
+	outside := filepath.Join(root, "outside")
+	if err := os.WriteFile(outside, []byte("secret\n"), 0644); err != nil {
+		t.Fatalf("can't write %s: %v", outside, err)
+	}
+
+	indexpath := filepath.Join(root, "index")
+	if _, err := (index.Idx{}).ReIndex(indexpath, tree); err != nil {
+		t.Fatalf("can't index %s: %v", tree, err)
+	}
+	// Links made after indexing: one escapes the tree, one stays in it.
+	if err := os.Symlink(outside, filepath.Join(tree, "escape")); err != nil {
+		t.Fatalf("can't link: %v", err)
+	}
+	if err := os.Symlink("small", filepath.Join(tree, "inner")); err != nil {
+		t.Fatalf("can't link: %v", err)
+	}
+
+	fi, err := os.Stat(filepath.Join(tree, "same"))
+	if err != nil {
+		t.Fatalf("can't stat: %v", err)
+	}
+
+	s := &Server{fs: filesystemimpl{}}
+	var resp FetchFilesResult
+	if err := s.FetchFiles(FetchFilesArgs{
+		Files: []FileRequest{
+			{Path: filepath.Join(tree, "small")},
+			{Path: filepath.Join(tree, "big")},
+			{Path: filepath.Join(tree, "same"), ModTime: fi.ModTime()},
+			{Path: filepath.Join(tree, "inner")},
+			{Path: outside},
+			{Path: filepath.Join(tree, "escape")},
+			{Path: filepath.Join(tree, "..", "outside")},
+			{Path: filepath.Join(tree, "missing"), ModTime: time.Now()},
+		},
+		Indexes: []base.Index{{Remotepath: indexpath}},
+		Limit:   16,
+	}, &resp); err != nil {
+		t.Fatalf("FetchFiles failed: %v", err)
+	}
+
+	if got, want := len(resp.Files), 8; got != want {
+		t.Fatalf("got %d files want %d", got, want)
+	}
+	if got, want := string(resp.Files[0].Contents), "small\n"; got != want {
+		t.Errorf("small got %q want %q", got, want)
+	}
+	if f := resp.Files[1]; !f.Skipped || f.Contents != nil {
+		t.Errorf("big wasn't skipped: %#v", f)
+	}
+	if f := resp.Files[2]; !f.NotModified || f.Contents != nil {
+		t.Errorf("same wasn't NotModified: %#v", f)
+	}
+	if got, want := string(resp.Files[3].Contents), "small\n"; got != want {
+		t.Errorf("inner got %q want %q", got, want)
+	}
+	for _, f := range resp.Files[4:] {
+		if f.Err == "" || f.Contents != nil {
+			t.Errorf("%s should have failed: %#v", f.Path, f)
+		}
+	}
+}
+
+func TestUnder(t *testing.T) {
+	roots := []string{"/a/b", "/c/"}
+	for _, tv := range []struct {
+		path string
+		want bool
+	}{
+		{"/a/b/c", true},
+		{"/a/b", true},
+		{"/a/bc", false},
+		{"/c/d", true},
+		{"/a/b/../x", false},
+	} {
+		if got := under(roots, tv.path); got != tv.want {
+			t.Errorf("under(%q) got %v want %v", tv.path, got, tv.want)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package server
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/rjkroege/leap/base"
+	"github.com/rjkroege/leap/git"
+)
+
+type GitStatusArgs struct {
+	// Roots are the server's paths of the indexed trees.
+	Roots []string
+	// Trace is the trace ID of the client's query.
+	Trace string
+}
+
+type GitStatusResult struct {
+	// Files is the git.Rank of the files with git activity.
+	Files map[string]int
+}
+
+// GitStatus summarizes the git activity in the working trees of
+// args.Roots so that a client can rank and filter the results of remote
+// projects as it does local ones.
+func (s *Server) GitStatus(args GitStatusArgs, resp *GitStatusResult) (err error) {
+	stime := time.Now()
+	defer func() {
+		s.stats.observe("GitStatus", stime, err)
+		slog.Info("GitStatus", base.TraceKey, args.Trace, "roots", len(args.Roots),
+			"files", len(resp.Files), "elapsed", time.Since(stime))
+	}()
+
+	runner := s.git
+	if runner == nil {
+		runner = git.Cmd{}
+	}
+	resp.Files = git.Read(runner, args.Roots).Files()
+	return nil
+}
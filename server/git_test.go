@@ -0,0 +1,36 @@
+package server
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/rjkroege/leap/git"
+)
+
+// mockGit answers git commands in the working tree /proj with a modified
+// file.
+type mockGit struct{}
+
+func (_ mockGit) Git(dir string, args ...string) ([]byte, error) {
+	switch {
+	case dir != "/proj":
+		return nil, fmt.Errorf("%s isn't in a working tree", dir)
+	case args[0] == "rev-parse":
+		return []byte("/proj\n"), nil
+	case args[0] == "status":
+		return []byte(" M pkg/a.go\n"), nil
+	}
+	return nil, fmt.Errorf("no git %s", args[0])
+}
+
+func TestGitStatus(t *testing.T) {
+	s := &Server{git: mockGit{}}
+	var resp GitStatusResult
+	if err := s.GitStatus(GitStatusArgs{Roots: []string{"/proj", "/elsewhere"}}, &resp); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if got, want := resp.Files, map[string]int{"/proj/pkg/a.go": git.Modified}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Files got %v want %v", got, want)
+	}
+}
@@ -6,7 +6,9 @@ import (
 	"io/ioutil"
 	"os"
 	"reflect"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/Redundancy/go-sync/chunks"
 	"github.com/Redundancy/go-sync/filechecksum"
@@ -103,8 +105,8 @@ func TestIndexAndBuildChecksumIndex(t *testing.T) {
 		{
 			name: "cindex failed test",
 			server: Server{
-				token:  1,
-				config: MockSuccessConfiguration{},
+				sessions: sessions{last: 1},
+				config:   MockSuccessConfiguration{},
 				indexer: MockIndexer{
 					result: []byte{},
 					err:    fmt.Errorf("can't fork cindex!"),
@@ -120,8 +122,8 @@ func TestIndexAndBuildChecksumIndex(t *testing.T) {
 		{
 			name: "cindex success but filepath not available",
 			server: Server{
-				token:  1,
-				config: MockSuccessConfiguration{},
+				sessions: sessions{last: 1},
+				config:   MockSuccessConfiguration{},
 				indexer: MockIndexer{
 					result: []byte("cindex success!"),
 					err:    nil,
@@ -138,9 +140,9 @@ func TestIndexAndBuildChecksumIndex(t *testing.T) {
 		{
 			name: "stat succeeded, open fails",
 			server: Server{
-				token:  1,
-				config: MockSuccessConfiguration{},
-				fs:     MockFilesystemPostStatError{},
+				sessions: sessions{last: 1},
+				config:   MockSuccessConfiguration{},
+				fs:       MockFilesystemPostStatError{},
 			},
 			args:          IndexAndBuildChecksumIndexArgs{},
 			expectedtoken: 1,
@@ -169,10 +171,10 @@ func TestIndexAndBuildChecksumIndex(t *testing.T) {
 		{
 			name: "BuildCheckSum fails",
 			server: Server{
-				token:  1,
-				config: MockSuccessConfiguration{},
-				fs:     filesystemimpl{},
-				build:  MockFailingBuilder{},
+				sessions: sessions{last: 1},
+				config:   MockSuccessConfiguration{},
+				fs:       filesystemimpl{},
+				build:    MockFailingBuilder{},
 			},
 			args:          IndexAndBuildChecksumIndexArgs{},
 			expectedtoken: 1,
@@ -195,8 +197,8 @@ func TestIndexAndBuildChecksumIndex(t *testing.T) {
 				fd.Close()
 			},
 			posttest: func(t *testing.T, tv *testVector) {
-				if err := tv.server.indexfile.Close(); err == nil {
-					t.Errorf("server.indexfile hadn't been closed")
+				if got := len(tv.server.sessions.open); got != 0 {
+					t.Errorf("failure opened %d transfer sessions", got)
 				}
 				os.Remove(tv.args.RemotePath)
 			},
@@ -204,10 +206,10 @@ func TestIndexAndBuildChecksumIndex(t *testing.T) {
 		{
 			name: "BuildCheckSum generates invalid results",
 			server: Server{
-				token:  1,
-				config: MockSuccessConfiguration{},
-				fs:     filesystemimpl{},
-				build:  MockBadBuildChecksumIndexResults{},
+				sessions: sessions{last: 1},
+				config:   MockSuccessConfiguration{},
+				fs:       filesystemimpl{},
+				build:    MockBadBuildChecksumIndexResults{},
 			},
 			args:          IndexAndBuildChecksumIndexArgs{},
 			expectedtoken: 1,
@@ -230,8 +232,8 @@ func TestIndexAndBuildChecksumIndex(t *testing.T) {
 				fd.Close()
 			},
 			posttest: func(t *testing.T, tv *testVector) {
-				if err := tv.server.indexfile.Close(); err == nil {
-					t.Errorf("server.indexfile hadn't been closed")
+				if got := len(tv.server.sessions.open); got != 0 {
+					t.Errorf("failure opened %d transfer sessions", got)
 				}
 				os.Remove(tv.args.RemotePath)
 			},
@@ -239,10 +241,10 @@ func TestIndexAndBuildChecksumIndex(t *testing.T) {
 		{
 			name: "BuildCheckSum returned correctly",
 			server: Server{
-				token:  3,
-				config: MockSuccessConfiguration{},
-				fs:     filesystemimpl{},
-				build:  builderimpl{},
+				sessions: sessions{last: 3},
+				config:   MockSuccessConfiguration{},
+				fs:       filesystemimpl{},
+				build:    builderimpl{},
 			},
 			args:          IndexAndBuildChecksumIndexArgs{},
 			expectedtoken: 4,
@@ -295,8 +297,12 @@ func TestIndexAndBuildChecksumIndex(t *testing.T) {
 				fd.Close()
 			},
 			posttest: func(t *testing.T, tv *testVector) {
-				if err := tv.server.indexfile.Close(); err != nil {
-					t.Errorf("server.indexfile should have been open but wasn't")
+				s, ok := tv.server.sessions.open[tv.expectedtoken]
+				if !ok {
+					t.Fatalf("no transfer session %d", tv.expectedtoken)
+				}
+				if err := s.file.Close(); err != nil {
+					t.Errorf("transfer session file should have been open but wasn't")
 				}
 				os.Remove(tv.args.RemotePath)
 			},
@@ -328,7 +334,7 @@ func TestIndexAndBuildChecksumIndex(t *testing.T) {
 			}
 		}
 
-		if got, want := test.server.token, test.expectedtoken; got != want {
+		if got, want := test.server.sessions.last, test.expectedtoken; got != want {
 			t.Errorf("%s did not correctly set token got %d want %d", test.name, got, want)
 		}
 
@@ -337,3 +343,46 @@ func TestIndexAndBuildChecksumIndex(t *testing.T) {
 		}
 	}
 }
+
+// MockConcurrentIndexer records the most ReIndex calls of the same index
+// that overlapped.
+type MockConcurrentIndexer struct {
+	lock     sync.Mutex
+	inflight map[string]int
+	most     int
+}
+
+func (mi *MockConcurrentIndexer) ReIndex(indexpath string, args ...string) ([]byte, error) {
+	mi.lock.Lock()
+	mi.inflight[indexpath]++
+	if n := mi.inflight[indexpath]; n > mi.most {
+		mi.most = n
+	}
+	mi.lock.Unlock()
+
+	time.Sleep(10 * time.Millisecond)
+
+	mi.lock.Lock()
+	mi.inflight[indexpath]--
+	mi.lock.Unlock()
+	return nil, fmt.Errorf("no index")
+}
+
+func TestIndexAndBuildChecksumIndexSerialized(t *testing.T) {
+	indexer := &MockConcurrentIndexer{inflight: make(map[string]int)}
+	s := &Server{indexer: indexer}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var result RemoteCheckSumIndexData
+			s.IndexAndBuildChecksumIndex(IndexAndBuildChecksumIndexArgs{RemotePath: "/proj.index"}, &result)
+		}()
+	}
+	wg.Wait()
+	if indexer.most != 1 {
+		t.Errorf("%d re-indexes of the same index overlapped", indexer.most)
+	}
+}
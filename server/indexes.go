@@ -0,0 +1,149 @@
+package server
+
+import (
+	"container/list"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/rjkroege/leap/search"
+)
+
+// MaxOpenIndexes is how many indexes the server keeps open. The least
+// recently used is closed to open another.
+const MaxOpenIndexes = 8
+
+// openIndex is an index kept open by the server.
+type openIndex struct {
+	// lock is held for reading while search is used and for writing
+	// while it's opened or closed.
+	lock    sync.RWMutex
+	path    string
+	search  *search.Search
+	ftime   time.Time
+	evicted bool
+}
+
+// close closes the search of e if it's open.
+func (e *openIndex) close() {
+	if e.search == nil {
+		return
+	}
+	if err := e.search.Close(); err != nil {
+		slog.Warn("can't close index", "path", e.path, "err", err)
+	}
+	e.search = nil
+}
+
+// indexes is an LRU of open indexes keyed by path. The zero value keeps
+// MaxOpenIndexes open.
+type indexes struct {
+	// lock protects entries and order but not the openIndex values.
+	lock    sync.Mutex
+	limit   int
+	entries map[string]*list.Element
+	// order has the most recently used openIndex at the front.
+	order *list.List
+
+	// open permits replacing search.OpenTrigramSearch.
+	open func(path string, prefixes []string) (*search.Search, error)
+}
+
+// entry returns the openIndex for path, making it the most recently used
+// and closing those beyond the limit.
+func (ixs *indexes) entry(path string) *openIndex {
+	ixs.lock.Lock()
+	if ixs.entries == nil {
+		ixs.entries = make(map[string]*list.Element)
+		ixs.order = list.New()
+	}
+	if el, ok := ixs.entries[path]; ok {
+		ixs.order.MoveToFront(el)
+		ixs.lock.Unlock()
+		return el.Value.(*openIndex)
+	}
+
+	e := &openIndex{path: path}
+	ixs.entries[path] = ixs.order.PushFront(e)
+	limit := ixs.limit
+	if limit <= 0 {
+		limit = MaxOpenIndexes
+	}
+	evicted := make([]*openIndex, 0)
+	for ixs.order.Len() > limit {
+		v := ixs.order.Remove(ixs.order.Back()).(*openIndex)
+		delete(ixs.entries, v.path)
+		evicted = append(evicted, v)
+	}
+	ixs.lock.Unlock()
+
+	// Waits for searches of the evicted indexes to finish.
+	for _, v := range evicted {
+		v.lock.Lock()
+		v.evicted = true
+		v.close()
+		v.lock.Unlock()
+	}
+	return e
+}
+
+// acquire returns a Search for the current contents of the index at
+// path. The caller must call release when it's done with the Search and
+// mustn't acquire another before then.
+func (ixs *indexes) acquire(path string, prefixes []string) (s *search.Search, release func(), err error) {
+	// Always get the time of the possibly new indexfile.
+	ntime, err := getFileTime(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("can't stat open indexfile %s: %v", path, err)
+	}
+
+	for {
+		e := ixs.entry(path)
+		e.lock.RLock()
+		if !e.evicted && e.search != nil && !e.ftime.Before(ntime) {
+			return e.search, e.lock.RUnlock, nil
+		}
+		e.lock.RUnlock()
+
+		e.lock.Lock()
+		if !e.evicted && (e.search == nil || e.ftime.Before(ntime)) {
+			e.close()
+			open := ixs.open
+			if open == nil {
+				open = search.OpenTrigramSearch
+			}
+			s, err := open(path, prefixes)
+			if err != nil {
+				e.lock.Unlock()
+				return nil, nil, err
+			}
+			s.DisablePreviews()
+			e.search = s
+			e.ftime = ntime
+		}
+		e.lock.Unlock()
+	}
+}
+
+// status returns the open indexes from the most recently used.
+func (ixs *indexes) status() []IndexStatus {
+	ixs.lock.Lock()
+	open := make([]*openIndex, 0, len(ixs.entries))
+	if ixs.order != nil {
+		for el := ixs.order.Front(); el != nil; el = el.Next() {
+			open = append(open, el.Value.(*openIndex))
+		}
+	}
+	ixs.lock.Unlock()
+
+	st := make([]IndexStatus, 0, len(open))
+	for _, e := range open {
+		e.lock.RLock()
+		if e.search != nil {
+			st = append(st, IndexStatus{Path: e.path, Modified: e.ftime})
+		}
+		e.lock.RUnlock()
+	}
+	return st
+}
@@ -0,0 +1,142 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/rjkroege/leap/index"
+)
+
+// makeIndexes indexes a tree for each of names and returns the paths of
+// the indexes.
+func makeIndexes(t *testing.T, names ...string) []string {
+	root := t.TempDir()
+	paths := make([]string, 0, len(names))
+	for _, name := range names {
+		tree := filepath.Join(root, name)
+		if err := os.MkdirAll(tree, 0755); err != nil {
+			t.Fatalf("can't make %s: %v", tree, err)
+		}
+		if err := os.WriteFile(filepath.Join(tree, "file"), []byte(name+"\n"), 0644); err != nil {
+			t.Fatalf("can't write in %s: %v", tree, err)
+		}
+		indexpath := filepath.Join(root, name+".index")
+		if _, err := (index.Idx{}).ReIndex(indexpath, tree); err != nil {
+			t.Fatalf("can't index %s: %v", tree, err)
+		}
+		paths = append(paths, indexpath)
+	}
+	return paths
+}
+
+func openPaths(ixs *indexes) []string {
+	paths := make([]string, 0)
+	for _, st := range ixs.status() {
+		paths = append(paths, st.Path)
+	}
+	return paths
+}
+
+func TestIndexesLRU(t *testing.T) {
+	paths := makeIndexes(t, "a", "b", "c")
+	ixs := &indexes{limit: 2}
+
+	acquire := func(path string) {
+		t.Helper()
+		s, release, err := ixs.acquire(path, nil)
+		if err != nil {
+			t.Fatalf("can't acquire %s: %v", path, err)
+		}
+		if got, want := s.GetName(), path; got != want {
+			t.Errorf("acquire got %s want %s", got, want)
+		}
+		release()
+	}
+
+	acquire(paths[0])
+	acquire(paths[1])
+	acquire(paths[0])
+	acquire(paths[2])
+	if got, want := openPaths(ixs), []string{paths[2], paths[0]}; !reflect.DeepEqual(got, want) {
+		t.Errorf("open got %v want %v", got, want)
+	}
+
+	if _, _, err := ixs.acquire(filepath.Join(t.TempDir(), "missing"), nil); err == nil {
+		t.Errorf("expected an error for a missing index")
+	}
+}
+
+func TestIndexesReopen(t *testing.T) {
+	path := makeIndexes(t, "a")[0]
+	ixs := new(indexes)
+
+	first, release, err := ixs.acquire(path, nil)
+	if err != nil {
+		t.Fatalf("can't acquire: %v", err)
+	}
+	release()
+	same, release, err := ixs.acquire(path, nil)
+	if err != nil {
+		t.Fatalf("can't acquire: %v", err)
+	}
+	release()
+	if same != first {
+		t.Errorf("unchanged index was reopened")
+	}
+
+	// A rebuilt index is reopened.
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	reopened, release, err := ixs.acquire(path, nil)
+	if err != nil {
+		t.Fatalf("can't acquire: %v", err)
+	}
+	release()
+	if reopened == first {
+		t.Errorf("rebuilt index wasn't reopened")
+	}
+	if got := openPaths(ixs); len(got) != 1 {
+		t.Errorf("open got %v want only %s", got, path)
+	}
+}
+
+func TestIndexesEvictWaits(t *testing.T) {
+	paths := makeIndexes(t, "a", "b")
+	ixs := &indexes{limit: 1}
+
+	s, release, err := ixs.acquire(paths[0], nil)
+	if err != nil {
+		t.Fatalf("can't acquire: %v", err)
+	}
+
+	done := make(chan error)
+	go func() {
+		_, release, err := ixs.acquire(paths[1], nil)
+		if err == nil {
+			release()
+		}
+		done <- err
+	}()
+
+	select {
+	case <-done:
+		t.Fatalf("evicted an index in use")
+	case <-time.After(50 * time.Millisecond):
+	}
+	// The index is still usable.
+	if got := s.Paths(); len(got) != 1 {
+		t.Errorf("Paths got %v", got)
+	}
+	release()
+	if err := <-done; err != nil {
+		t.Fatalf("can't acquire: %v", err)
+	}
+	if got, want := openPaths(ixs), []string{paths[1]}; !reflect.DeepEqual(got, want) {
+		t.Errorf("open got %v want %v", got, want)
+	}
+}
@@ -16,8 +16,9 @@ import (
 	grsync "github.com/Redundancy/go-sync/index"
 	"github.com/Redundancy/go-sync/indexbuilder"
 	"github.com/rjkroege/leap/base"
+	"github.com/rjkroege/leap/export"
+	"github.com/rjkroege/leap/git"
 	"github.com/rjkroege/leap/index"
-	"github.com/rjkroege/leap/search"
 )
 
 // Configuration is for mocking the Configuration code.
@@ -34,17 +35,29 @@ type ReaderAtCloser interface {
 }
 
 type Server struct {
-	ftime  time.Time
-	config Configuration
-	lock   sync.Mutex
-	search *search.Search
+	config  Configuration
+	lock    sync.Mutex
+	indexes indexes
 
-	indexfile ReaderAtCloser
-	token     int
+	sessions sessions
+	// reindexing serializes re-indexing each index: the indexer's
+	// temporary files are named after the index.
+	reindexing pathLocks
 
 	indexer Indexer
 	fs      filesystem
 	build   builder
+	// git permits replacing git.Cmd.
+	git git.Runner
+
+	// Where to serve 9P if asked to export files. Empty to not export.
+	exportaddr string
+	// exportwrite lets 9P clients change the exported files.
+	exportwrite bool
+	exporter    *export.Server
+	exportport  int
+
+	stats stats
 }
 
 func getFileTime(filename string) (time.Time, error) {
@@ -61,18 +74,35 @@ func getFileTime(filename string) (time.Time, error) {
 // of each RemoteContentSearchResult RPC invocation. There is no need to
 // persist them as part of the Server object.
 func BeginServing(config Configuration) {
+	BeginServingWithExport(config, "", false)
+}
+
+// BeginServingWithExport is BeginServing for a server that can export
+// the indexed trees over 9P on exportaddr. An exportaddr without a host
+// is on the loopback interface. The export is read-only unless writable.
+func BeginServingWithExport(config Configuration, exportaddr string, writable bool) {
 	state := &Server{
 		// Do I needz config?
-		config:  config,
-		indexer: index.Idx{},
-		fs:      filesystemimpl{},
-		build:   builderimpl{},
+		config:      config,
+		indexer:     index.Idx{},
+		fs:          filesystemimpl{},
+		build:       builderimpl{},
+		exportaddr:  exportaddr,
+		exportwrite: writable,
 	}
+	state.stats.started = time.Now()
+	go func() {
+		for range time.Tick(time.Minute) {
+			state.sessions.reap()
+		}
+	}()
 
 	// The argument to rpc.Register can be any interface. It's public methods become the
 	// methods available on the server via Go rpc.
 	rpc.Register(state)
 	rpc.HandleHTTP()
+	http.HandleFunc("/status", state.serveStatus)
+	http.HandleFunc("/metrics", state.serveMetrics)
 
 	l, e := net.Listen("tcp", ":1234")
 	if e != nil {
@@ -81,32 +111,6 @@ func BeginServing(config Configuration) {
 	http.Serve(l, nil)
 }
 
-func (t *Server) ensureValidSearchObject(indexname string, prefixes []string) error {
-	t.lock.Lock()
-	defer t.lock.Unlock()
-
-	// Always get the time of the possibly new indexfile.
-	ntime, err := getFileTime(indexname)
-	if err != nil {
-		return fmt.Errorf("can't stat open indexfile %s: %v", indexname, err)
-	}
-
-	if t.search != nil && t.search.GetName() == indexname && !t.ftime.Before(ntime) {
-		return nil
-	}
-
-	// I have to make a new Search instance. Clean up the old one.
-	if t.indexfile != nil {
-		t.indexfile.Close()
-	}
-	// TODO(rjk): Cleanup. The lack of cleanup here will cause the server
-	// side to leak memory.
-	t.search = search.NewTrigramSearch(indexname, prefixes)
-	t.ftime = ntime
-
-	return nil
-}
-
 func (t *Server) Shutdown(_ string, result *string) error {
 	log.Println("shutting down...")
 	os.Exit(0)
@@ -125,6 +129,7 @@ type IndexAndBuildChecksumIndexArgs struct {
 }
 
 type RemoteCheckSumIndexData struct {
+	// Token is the ID of the transfer session for DoRequestOnServer.
 	Token                int
 	CindexOutput         []byte
 	FileSize             int64
@@ -132,6 +137,30 @@ type RemoteCheckSumIndexData struct {
 	StrongChecksumGetter chunks.StrongChecksumGetter
 }
 
+// pathLocks are mutexes keyed by path. The zero value is ready to use.
+type pathLocks struct {
+	lock  sync.Mutex
+	paths map[string]*sync.Mutex
+}
+
+// acquire waits for the mutex of path and returns the function that
+// releases it.
+func (pl *pathLocks) acquire(path string) func() {
+	pl.lock.Lock()
+	if pl.paths == nil {
+		pl.paths = make(map[string]*sync.Mutex)
+	}
+	m, ok := pl.paths[path]
+	if !ok {
+		m = new(sync.Mutex)
+		pl.paths[path] = m
+	}
+	pl.lock.Unlock()
+
+	m.Lock()
+	return m.Unlock
+}
+
 // Indexer lets me mock out the interface to the use of cindex.
 type Indexer interface {
 	ReIndex(indexpath string, args ...string) ([]byte, error)
@@ -169,8 +198,12 @@ func (_ builderimpl) BuildChecksumIndex(check *filechecksum.FileChecksumGenerato
 	return indexbuilder.BuildChecksumIndex(check, r)
 }
 
-func (s *Server) IndexAndBuildChecksumIndex(args IndexAndBuildChecksumIndexArgs, resp *RemoteCheckSumIndexData) error {
-	// Re-index
+func (s *Server) IndexAndBuildChecksumIndex(args IndexAndBuildChecksumIndexArgs, resp *RemoteCheckSumIndexData) (err error) {
+	defer func(stime time.Time) { s.stats.observe("IndexAndBuildChecksumIndex", stime, err) }(time.Now())
+
+	// Re-index. Concurrent syncs of the same index wait until it's been
+	// rebuilt and opened for their session.
+	defer s.reindexing.acquire(args.RemotePath)()
 	stdout, err := s.indexer.ReIndex(args.RemotePath)
 	if err != nil {
 		return fmt.Errorf("remote index command failed because: %v", err)
@@ -191,7 +224,6 @@ func (s *Server) IndexAndBuildChecksumIndex(args IndexAndBuildChecksumIndexArgs,
 	if err != nil {
 		return fmt.Errorf("can't open remote index %s because %v", indexpath, err)
 	}
-	s.indexfile = indexfile
 
 	generator := filechecksum.NewFileChecksumGenerator(BLOCK_SIZE)
 	_, referenceFileIndex, checksumLookup, err := s.build.BuildChecksumIndex(generator, indexfile)
@@ -209,7 +241,6 @@ func (s *Server) IndexAndBuildChecksumIndex(args IndexAndBuildChecksumIndexArgs,
 		return fmt.Errorf("can't convert checksumLookup into a concrete StrongChecksumGetter")
 	}
 	resp.StrongChecksumGetter = scg
-	s.token += 1
-	resp.Token = s.token
+	resp.Token = s.sessions.begin(indexpath, indexfile, resp.FileSize)
 	return nil
 }
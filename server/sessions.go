@@ -0,0 +1,136 @@
+package server
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+)
+
+// SessionTimeout is how long a transfer session is kept after its last
+// request. Clients don't say when they're done so sessions end by
+// expiring.
+const SessionTimeout = 5 * time.Minute
+
+// session is the transfer of an index to a client by DoRequestOnServer.
+type session struct {
+	file    ReaderAtCloser
+	status  TransferStatus
+	expires time.Time
+	// users counts the reads of file in progress.
+	users int
+}
+
+// sessions are the open transfer sessions keyed by their ID, the token
+// of the IndexAndBuildChecksumIndex that began them. The zero value has
+// none.
+type sessions struct {
+	lock sync.Mutex
+	// last is the ID of the newest session.
+	last int
+	open map[int]*session
+
+	// now permits replacing time.Now.
+	now func() time.Time
+}
+
+func (ss *sessions) clock() time.Time {
+	if ss.now == nil {
+		return time.Now()
+	}
+	return ss.now()
+}
+
+// begin opens a session transferring file, the index at path of size
+// bytes, and returns its ID. The session owns file.
+func (ss *sessions) begin(path string, file ReaderAtCloser, size int64) int {
+	ss.lock.Lock()
+	defer ss.lock.Unlock()
+	now := ss.clock()
+	ss.reapLocked(now)
+
+	if ss.open == nil {
+		ss.open = make(map[int]*session)
+	}
+	ss.last++
+	ss.open[ss.last] = &session{
+		file: file,
+		status: TransferStatus{
+			Token:   ss.last,
+			Path:    path,
+			Size:    size,
+			Started: now,
+		},
+		expires: now.Add(SessionTimeout),
+	}
+	return ss.last
+}
+
+// read returns the bytes from start up to end of the index of session id
+// and extends its expiry. end is clamped to the size of the index.
+func (ss *sessions) read(id int, start, end int64) ([]byte, error) {
+	ss.lock.Lock()
+	s, ok := ss.open[id]
+	if !ok {
+		ss.lock.Unlock()
+		return nil, fmt.Errorf("no transfer session %d: it expired or the server restarted", id)
+	}
+	size := s.status.Size
+	if end > size {
+		end = size
+	}
+	if start < 0 || start > size || end < start {
+		ss.lock.Unlock()
+		return nil, fmt.Errorf("bad block request [%d, %d) of %d bytes", start, end, size)
+	}
+	s.expires = ss.clock().Add(SessionTimeout)
+	s.users++
+	ss.lock.Unlock()
+
+	p := make([]byte, end-start)
+	_, err := s.file.ReadAt(p, start)
+
+	ss.lock.Lock()
+	defer ss.lock.Unlock()
+	s.users--
+	if err != nil {
+		return nil, err
+	}
+	s.status.Sent += int64(len(p))
+	return p, nil
+}
+
+// reap closes the expired sessions.
+func (ss *sessions) reap() {
+	ss.lock.Lock()
+	defer ss.lock.Unlock()
+	ss.reapLocked(ss.clock())
+}
+
+func (ss *sessions) reapLocked(now time.Time) {
+	for id, s := range ss.open {
+		if s.users > 0 || now.Before(s.expires) {
+			continue
+		}
+		if err := s.file.Close(); err != nil {
+			slog.Warn("can't close index of transfer session", "session", id, "path", s.status.Path, "err", err)
+		}
+		delete(ss.open, id)
+	}
+}
+
+// transfers returns the ID of the newest session and the status of the
+// open sessions from the oldest.
+func (ss *sessions) transfers() (int, []TransferStatus) {
+	ss.lock.Lock()
+	defer ss.lock.Unlock()
+	st := make([]TransferStatus, 0, len(ss.open))
+	for _, s := range ss.open {
+		tr := s.status
+		tr.Expires = s.expires
+		st = append(st, tr)
+	}
+	sort.Slice(st, func(i, j int) bool { return st[i].Token < st[j].Token })
+	return ss.last, st
+}
@@ -0,0 +1,86 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+// closeCounter is a TestReaderAt that counts its Close calls.
+type closeCounter struct {
+	TestReaderAt
+	closed int
+}
+
+func (c *closeCounter) Close() error {
+	c.closed++
+	return nil
+}
+
+func TestSessions(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	ss := &sessions{now: func() time.Time { return now }}
+
+	first := &closeCounter{TestReaderAt: TestReaderAt{contents: buffercontents}}
+	second := &closeCounter{TestReaderAt: TestReaderAt{contents: "another index"}}
+	a := ss.begin("/a.index", first, int64(len(buffercontents)))
+	b := ss.begin("/b.index", second, 13)
+	if a == b {
+		t.Fatalf("sessions share ID %d", a)
+	}
+
+	// Both sessions can be read at once.
+	if buffy, err := ss.read(a, 0, 5); err != nil || string(buffy) != "hello" {
+		t.Errorf("read %d got %q, %v want hello", a, buffy, err)
+	}
+	if buffy, err := ss.read(b, 0, 5); err != nil || string(buffy) != "anoth" {
+		t.Errorf("read %d got %q, %v want anoth", b, buffy, err)
+	}
+
+	// Reads extend a session.
+	now = now.Add(SessionTimeout - time.Second)
+	if _, err := ss.read(a, 0, 5); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+	now = now.Add(2 * time.Second)
+	ss.reap()
+	if first.closed != 0 || second.closed != 1 {
+		t.Errorf("reap closed %d and %d times want 0 and 1", first.closed, second.closed)
+	}
+	if _, err := ss.read(b, 0, 5); err == nil {
+		t.Errorf("expected an error reading an expired session")
+	}
+
+	last, transfers := ss.transfers()
+	if last != b || len(transfers) != 1 || transfers[0].Token != a || transfers[0].Sent != 10 {
+		t.Errorf("transfers got %d, %v", last, transfers)
+	}
+
+	// Beginning a session reaps the abandoned ones.
+	now = now.Add(SessionTimeout)
+	c := ss.begin("/a.index", &closeCounter{}, 0)
+	if first.closed != 1 {
+		t.Errorf("abandoned session wasn't closed")
+	}
+	if _, transfers := ss.transfers(); len(transfers) != 1 || transfers[0].Token != c {
+		t.Errorf("transfers got %v want only %d", transfers, c)
+	}
+}
+
+func TestSessionsReadRange(t *testing.T) {
+	ss := new(sessions)
+	id := ss.begin("/a.index", &TestReaderAt{contents: buffercontents}, int64(len(buffercontents)))
+	size := int64(len(buffercontents))
+
+	// The end is clamped to the size of the index.
+	if buffy, err := ss.read(id, size-6, 1<<40); err != nil || string(buffy) != "buffer" {
+		t.Errorf("read past the end got %q, %v want buffer", buffy, err)
+	}
+	for _, r := range [][2]int64{{-1, 5}, {size + 1, size + 10}, {5, 2}} {
+		if _, err := ss.read(id, r[0], r[1]); err == nil {
+			t.Errorf("read [%d, %d) expected an error", r[0], r[1])
+		}
+	}
+	if _, transfers := ss.transfers(); transfers[0].Sent != 6 {
+		t.Errorf("Sent got %d want 6", transfers[0].Sent)
+	}
+}
@@ -0,0 +1,165 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Status describes the state of a server. It's served as JSON at
+// /status.
+type Status struct {
+	// Now is the server's time: ages are relative to it.
+	Now     time.Time
+	Started time.Time
+	Indexes []IndexStatus
+	Methods []MethodStatus
+	// Token is the ID of the newest transfer session.
+	Token     int
+	Transfers []TransferStatus
+}
+
+// IndexStatus is an index open in the server.
+type IndexStatus struct {
+	Path string
+	// Modified is when the index was last built.
+	Modified time.Time
+}
+
+// MethodStatus counts the calls of an RPC method.
+type MethodStatus struct {
+	Method string
+	Count  int64
+	Errors int64
+	// Total is the sum of the latencies of the calls.
+	Total time.Duration
+	Max   time.Duration
+}
+
+// TransferStatus is an open transfer session: an index being sent to a
+// client by DoRequestOnServer.
+type TransferStatus struct {
+	// Token is the ID of the session.
+	Token   int
+	Path    string
+	Size    int64
+	Sent    int64
+	Started time.Time
+	// Expires is when the session is closed unless it's used.
+	Expires time.Time
+}
+
+// stats are the counts reported by /status and /metrics.
+type stats struct {
+	lock    sync.Mutex
+	started time.Time
+	methods map[string]*MethodStatus
+}
+
+// observe counts a call of method that started at start and failed if
+// err isn't nil.
+func (st *stats) observe(method string, start time.Time, err error) {
+	d := time.Since(start)
+	st.lock.Lock()
+	defer st.lock.Unlock()
+	if st.methods == nil {
+		st.methods = make(map[string]*MethodStatus)
+	}
+	m, ok := st.methods[method]
+	if !ok {
+		m = &MethodStatus{Method: method}
+		st.methods[method] = m
+	}
+	m.Count++
+	if err != nil {
+		m.Errors++
+	}
+	m.Total += d
+	if d > m.Max {
+		m.Max = d
+	}
+}
+
+// status returns the Status of s at now.
+func (s *Server) status(now time.Time) *Status {
+	st := &Status{
+		Now:     now,
+		Indexes: make([]IndexStatus, 0),
+		Methods: make([]MethodStatus, 0),
+	}
+
+	st.Indexes = append(st.Indexes, s.indexes.status()...)
+	st.Token, st.Transfers = s.sessions.transfers()
+
+	s.stats.lock.Lock()
+	defer s.stats.lock.Unlock()
+	st.Started = s.stats.started
+	for _, m := range s.stats.methods {
+		st.Methods = append(st.Methods, *m)
+	}
+	sort.Slice(st.Methods, func(i, j int) bool { return st.Methods[i].Method < st.Methods[j].Method })
+	return st
+}
+
+// serveStatus serves the server's Status as JSON.
+func (s *Server) serveStatus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(s.status(time.Now())); err != nil {
+		slog.Warn("can't send status", "remote", r.RemoteAddr, "err", err)
+	}
+}
+
+// serveMetrics serves the server's Status in the Prometheus text format.
+func (s *Server) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	writeMetrics(w, s.status(time.Now()))
+}
+
+// writeMetrics writes st to w in the Prometheus text format.
+func writeMetrics(w io.Writer, st *Status) {
+	metric := func(name, kind, help string) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+	}
+
+	metric("leap_uptime_seconds", "gauge", "Time since the server started.")
+	fmt.Fprintf(w, "leap_uptime_seconds %g\n", st.Now.Sub(st.Started).Seconds())
+
+	metric("leap_indexes_loaded", "gauge", "Indexes open for searching.")
+	fmt.Fprintf(w, "leap_indexes_loaded %d\n", len(st.Indexes))
+	metric("leap_index_age_seconds", "gauge", "Time since each loaded index was built.")
+	for _, ix := range st.Indexes {
+		fmt.Fprintf(w, "leap_index_age_seconds{index=%q} %g\n", ix.Path, st.Now.Sub(ix.Modified).Seconds())
+	}
+
+	metric("leap_requests_total", "counter", "RPCs served by method.")
+	for _, m := range st.Methods {
+		fmt.Fprintf(w, "leap_requests_total{method=%q} %d\n", m.Method, m.Count)
+	}
+	metric("leap_request_errors_total", "counter", "RPCs that failed by method.")
+	for _, m := range st.Methods {
+		fmt.Fprintf(w, "leap_request_errors_total{method=%q} %d\n", m.Method, m.Errors)
+	}
+	metric("leap_request_duration_seconds", "summary", "Latency of RPCs by method.")
+	for _, m := range st.Methods {
+		fmt.Fprintf(w, "leap_request_duration_seconds_sum{method=%q} %g\n", m.Method, m.Total.Seconds())
+		fmt.Fprintf(w, "leap_request_duration_seconds_count{method=%q} %d\n", m.Method, m.Count)
+	}
+	metric("leap_request_duration_max_seconds", "gauge", "Slowest RPC by method.")
+	for _, m := range st.Methods {
+		fmt.Fprintf(w, "leap_request_duration_max_seconds{method=%q} %g\n", m.Method, m.Max.Seconds())
+	}
+
+	metric("leap_sync_token", "gauge", "ID of the newest transfer session.")
+	fmt.Fprintf(w, "leap_sync_token %d\n", st.Token)
+	metric("leap_transfers_in_flight", "gauge", "Open transfer sessions.")
+	fmt.Fprintf(w, "leap_transfers_in_flight %d\n", len(st.Transfers))
+	metric("leap_transfer_sent_bytes", "gauge", "Bytes sent by each open transfer session.")
+	for _, tr := range st.Transfers {
+		fmt.Fprintf(w, "leap_transfer_sent_bytes{index=%q,session=\"%d\"} %d\n", tr.Path, tr.Token, tr.Sent)
+	}
+}
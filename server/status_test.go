@@ -0,0 +1,85 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStatus(t *testing.T) {
+	s := &Server{sessions: sessions{last: 2}}
+	s.stats.started = time.Now().Add(-time.Hour)
+	s.sessions.begin("/remote/index", &TestReaderAt{contents: buffercontents}, int64(len(buffercontents)))
+
+	var result []byte
+	if err := s.DoRequestOnServer(DoRequestArgs{Start: 0, End: 5, Token: 3}, &result); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if err := s.DoRequestOnServer(DoRequestArgs{Start: 0, End: 5, Token: 2}, &result); err == nil {
+		t.Fatalf("expected an error for a missing session")
+	}
+	s.stats.observe("RemoteContentSearchResult", time.Now(), errors.New("failed"))
+
+	rec := httptest.NewRecorder()
+	s.serveStatus(rec, httptest.NewRequest("GET", "/status", nil))
+	st := new(Status)
+	if err := json.NewDecoder(rec.Body).Decode(st); err != nil {
+		t.Fatalf("can't decode status: %v", err)
+	}
+
+	if got, want := len(st.Methods), 2; got != want {
+		t.Fatalf("got %d methods want %d: %v", got, want, st.Methods)
+	}
+	if m := st.Methods[0]; m.Method != "DoRequestOnServer" || m.Count != 2 || m.Errors != 1 {
+		t.Errorf("unexpected DoRequestOnServer status %#v", m)
+	}
+	if m := st.Methods[1]; m.Method != "RemoteContentSearchResult" || m.Count != 1 || m.Errors != 1 {
+		t.Errorf("unexpected RemoteContentSearchResult status %#v", m)
+	}
+	if got, want := st.Token, 3; got != want {
+		t.Errorf("Token got %d want %d", got, want)
+	}
+	if len(st.Transfers) != 1 || st.Transfers[0].Sent != 5 || st.Transfers[0].Path != "/remote/index" {
+		t.Errorf("unexpected transfers %v", st.Transfers)
+	}
+
+	// The session is open until it expires.
+	s.sessions.now = func() time.Time { return time.Now().Add(SessionTimeout + time.Second) }
+	s.sessions.reap()
+	if tr := s.status(time.Now()).Transfers; len(tr) != 0 {
+		t.Errorf("expired transfer is open: %v", tr)
+	}
+}
+
+func TestWriteMetrics(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	st := &Status{
+		Now:     now,
+		Started: now.Add(-90 * time.Second),
+		Indexes: []IndexStatus{{Path: "/remote/index", Modified: now.Add(-time.Hour)}},
+		Methods: []MethodStatus{{Method: "FetchFiles", Count: 4, Errors: 1, Total: 2 * time.Second, Max: time.Second}},
+		Token:   2,
+	}
+	buffy := new(bytes.Buffer)
+	writeMetrics(buffy, st)
+
+	for _, want := range []string{
+		"# TYPE leap_uptime_seconds gauge\nleap_uptime_seconds 90\n",
+		"leap_indexes_loaded 1\n",
+		"leap_index_age_seconds{index=\"/remote/index\"} 3600\n",
+		"leap_requests_total{method=\"FetchFiles\"} 4\n",
+		"leap_request_errors_total{method=\"FetchFiles\"} 1\n",
+		"leap_request_duration_seconds_sum{method=\"FetchFiles\"} 2\n",
+		"leap_request_duration_seconds_count{method=\"FetchFiles\"} 4\n",
+		"leap_sync_token 2\n",
+		"leap_transfers_in_flight 0\n",
+	} {
+		if !strings.Contains(buffy.String(), want) {
+			t.Errorf("metrics %q are missing %q", buffy.String(), want)
+		}
+	}
+}